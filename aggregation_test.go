@@ -5,6 +5,7 @@ package roaring
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"math/rand"
 	"testing"
 )
 
@@ -229,9 +230,12 @@ func TestParAggregations(t *testing.T) {
 		orFunc := func(bitmaps ...*Bitmap) *Bitmap {
 			return ParOr(p, bitmaps...)
 		}
+		xorFunc := func(bitmaps ...*Bitmap) *Bitmap {
+			return ParXor(p, bitmaps...)
+		}
 
 		t.Run(fmt.Sprintf("par%d", p), func(t *testing.T) {
-			testAggregations(t, andFunc, orFunc, nil)
+			testAggregations(t, andFunc, orFunc, xorFunc)
 		})
 	}
 }
@@ -245,9 +249,145 @@ func TestParHeapAggregations(t *testing.T) {
 }
 
 func TestFastAggregations(t *testing.T) {
-	testAggregations(t, FastAnd, FastOr, nil)
+	testAggregations(t, FastAnd, FastOr, FastXor)
 }
 
 func TestHeapAggregations(t *testing.T) {
 	testAggregations(t, nil, HeapOr, HeapXor)
 }
+
+// randomAggregationInputs returns bitmaps mixing the three container types,
+// some of them with copy-on-write containers
+func randomAggregationInputs(r *rand.Rand, count int) []*Bitmap {
+	var bitmaps []*Bitmap
+	for i := 0; i < count; i++ {
+		rb := NewBitmap()
+		for j := 0; j < 3000; j++ {
+			rb.Add(uint32(r.Intn(40 << 16)))
+		}
+		for j := 0; j < 3; j++ {
+			start := uint64(r.Intn(40 << 16))
+			rb.AddRange(start, start+uint64(r.Intn(3<<16)))
+		}
+		switch i % 3 {
+		case 1:
+			rb.RunOptimize()
+		case 2:
+			buf, _ := rb.ToBytes()
+			rb = NewBitmap()
+			rb.FromBuffer(buf)
+		}
+		bitmaps = append(bitmaps, rb)
+	}
+	// a bitmap that cancels itself out in xor
+	bitmaps = append(bitmaps, bitmaps[0].Clone())
+	return bitmaps
+}
+
+func TestXorAggregationsRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+	for trial := 0; trial < 5; trial++ {
+		bitmaps := randomAggregationInputs(r, 2+trial*3)
+		var clones []*Bitmap
+		for _, b := range bitmaps {
+			clones = append(clones, b.Clone())
+		}
+
+		expected := NewBitmap()
+		for _, b := range bitmaps {
+			expected.Xor(b)
+		}
+		fast := FastXor(bitmaps...)
+		assert.True(t, expected.Equals(fast))
+		assert.Equal(t, expected.GetCardinality(), fast.GetCardinality())
+		for _, p := range []int{0, 1, 3} {
+			assert.True(t, expected.Equals(ParXor(p, bitmaps...)))
+		}
+		for i, b := range bitmaps {
+			assert.True(t, clones[i].Equals(b))
+		}
+	}
+	assert.True(t, FastXor(BitmapOf(1, 2), BitmapOf(1, 2)).IsEmpty())
+	assert.Equal(t, 0, FastXor(BitmapOf(1, 2), BitmapOf(1, 2)).highlowcontainer.size())
+}
+
+func TestAndNotAggregations(t *testing.T) {
+	r := rand.New(rand.NewSource(10))
+	for trial := 0; trial < 5; trial++ {
+		bitmaps := randomAggregationInputs(r, 2+trial*3)
+		base := bitmaps[trial%len(bitmaps)]
+		others := bitmaps[1:]
+		var clones []*Bitmap
+		for _, b := range bitmaps {
+			clones = append(clones, b.Clone())
+		}
+
+		expected := base.Clone()
+		for _, b := range others {
+			expected.AndNot(b)
+		}
+		fast := FastAndNot(base, others...)
+		assert.True(t, expected.Equals(fast))
+		assert.Equal(t, expected.GetCardinality(), fast.GetCardinality())
+		for _, p := range []int{0, 1, 3} {
+			assert.True(t, expected.Equals(ParAndNot(p, base, others...)))
+		}
+		for i, b := range bitmaps {
+			assert.True(t, clones[i].Equals(b))
+		}
+	}
+
+	base := BitmapOf(1, 2, 3, 1<<16, 1<<17)
+	assert.True(t, base.Equals(FastAndNot(base)))
+	assert.True(t, FastAndNot(base, base).IsEmpty())
+	assert.True(t, BitmapOf(2, 1<<17).Equals(FastAndNot(base, BitmapOf(1, 3), BitmapOf(1<<16))))
+	assert.True(t, BitmapOf(2, 1<<17).Equals(ParAndNot(2, base, BitmapOf(1, 3), BitmapOf(1<<16))))
+	assert.True(t, ParAndNot(0, NewBitmap(), base).IsEmpty())
+}
+
+func TestThresholdAggregations(t *testing.T) {
+	r := rand.New(rand.NewSource(12))
+	for trial := 0; trial < 4; trial++ {
+		bitmaps := randomAggregationInputs(r, 3+trial*3)
+		// dense bitmap containers
+		for j := 0; j < 30000; j++ {
+			bitmaps[1].Add(uint32(r.Intn(4 << 16)))
+		}
+		var clones []*Bitmap
+		counts := make([]int, 43<<16)
+		for _, b := range bitmaps {
+			clones = append(clones, b.Clone())
+			b.Iterate(func(x uint32) bool {
+				counts[x]++
+				return true
+			})
+		}
+
+		for _, k := range []int{0, 1, 2, 3, len(bitmaps) - 1, len(bitmaps), len(bitmaps) + 1} {
+			expected := NewBitmap()
+			for x, c := range counts {
+				if c >= k && c > 0 {
+					expected.Add(uint32(x))
+				}
+			}
+			answer := Threshold(k, bitmaps...)
+			assert.True(t, expected.Equals(answer), "k=%d", k)
+			assert.Equal(t, expected.GetCardinality(), answer.GetCardinality(), "k=%d", k)
+			for _, p := range []int{0, 1, 3} {
+				assert.True(t, expected.Equals(ParThreshold(p, k, bitmaps...)), "k=%d", k)
+			}
+		}
+		for i, b := range bitmaps {
+			assert.True(t, clones[i].Equals(b))
+		}
+	}
+
+	a := BitmapOf(1, 2, 3, 1<<16)
+	b := BitmapOf(2, 3, 4, 1<<16)
+	c := BitmapOf(3, 4, 5, 2<<16)
+	assert.True(t, BitmapOf(2, 3, 4, 1<<16).Equals(Threshold(2, a, b, c)))
+	assert.True(t, BitmapOf(3).Equals(Threshold(3, a, b, c)))
+	assert.True(t, Or(Or(a, b), c).Equals(Threshold(1, a, b, c)))
+	assert.True(t, Threshold(2).IsEmpty())
+	assert.True(t, ParThreshold(0, 1, NewBitmap(), NewBitmap()).IsEmpty())
+}
@@ -860,6 +860,46 @@ func (ac *arrayContainer) contains(x uint16) bool {
 	return binarySearch(ac.content, x) >= 0
 }
 
+// lowerBound returns the index of the first value that is at least x
+func (ac *arrayContainer) lowerBound(x uint) int {
+	if x > MaxUint16 {
+		return len(ac.content)
+	}
+	i := binarySearch(ac.content, uint16(x))
+	if i < 0 {
+		return -i - 1
+	}
+	return i
+}
+
+func (ac *arrayContainer) getCardinalityInRange(start, end uint) int {
+	if start >= end {
+		return 0
+	}
+	return ac.lowerBound(end) - ac.lowerBound(start)
+}
+
+func (ac *arrayContainer) containsRange(start, end uint) bool {
+	if start >= end {
+		return true
+	}
+	lo := ac.lowerBound(start)
+	hi := lo + int(end-start) - 1
+	if hi >= len(ac.content) {
+		return false
+	}
+	// the values are strictly increasing
+	return uint(ac.content[lo]) == start && uint(ac.content[hi]) == end-1
+}
+
+func (ac *arrayContainer) intersectsRange(start, end uint) bool {
+	if start >= end {
+		return false
+	}
+	lo := ac.lowerBound(start)
+	return lo < len(ac.content) && uint(ac.content[lo]) < end
+}
+
 func (ac *arrayContainer) loadData(bitmapContainer *bitmapContainer) {
 	ac.content = make([]uint16, bitmapContainer.cardinality, bitmapContainer.cardinality)
 	bitmapContainer.fillArray(ac.content)
@@ -953,6 +993,21 @@ func (ac *arrayContainer) containerType() contype {
 	return arrayContype
 }
 
+func (ac *arrayContainer) validate() error {
+	if len(ac.content) == 0 {
+		return fmt.Errorf("empty array container")
+	}
+	if len(ac.content) > arrayDefaultMaxSize {
+		return fmt.Errorf("array container with cardinality %d, above %d", len(ac.content), arrayDefaultMaxSize)
+	}
+	for i := 1; i < len(ac.content); i++ {
+		if ac.content[i] <= ac.content[i-1] {
+			return fmt.Errorf("array values not strictly increasing at position %d: %d after %d", i, ac.content[i], ac.content[i-1])
+		}
+	}
+	return nil
+}
+
 func (ac *arrayContainer) addOffset(x uint16) []container {
 	low := &arrayContainer{}
 	high := &arrayContainer{}
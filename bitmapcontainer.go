@@ -765,6 +765,51 @@ func (bc *bitmapContainer) getCardinalityInRange(start, end uint) int {
 	return int(answer)
 }
 
+func (bc *bitmapContainer) containsRange(start, end uint) bool {
+	if start >= end {
+		return true
+	}
+	firstword := start / 64
+	endword := (end - 1) / 64
+	const allones = ^uint64(0)
+	if firstword == endword {
+		mask := (allones << (start % 64)) & (allones >> ((64 - end) & 63))
+		return bc.bitmap[firstword]&mask == mask
+	}
+	first := allones << (start % 64)
+	if bc.bitmap[firstword]&first != first {
+		return false
+	}
+	for _, w := range bc.bitmap[firstword+1 : endword] {
+		if w != allones {
+			return false
+		}
+	}
+	last := allones >> ((64 - end) & 63)
+	return bc.bitmap[endword]&last == last
+}
+
+func (bc *bitmapContainer) intersectsRange(start, end uint) bool {
+	if start >= end {
+		return false
+	}
+	firstword := start / 64
+	endword := (end - 1) / 64
+	const allones = ^uint64(0)
+	if firstword == endword {
+		return bc.bitmap[firstword]&(allones<<(start%64))&(allones>>((64-end)&63)) != 0
+	}
+	if bc.bitmap[firstword]&(allones<<(start%64)) != 0 {
+		return true
+	}
+	for _, w := range bc.bitmap[firstword+1 : endword] {
+		if w != 0 {
+			return true
+		}
+	}
+	return bc.bitmap[endword]&(allones>>((64-end)&63)) != 0
+}
+
 func (bc *bitmapContainer) andBitmap(value2 *bitmapContainer) container {
 	newcardinality := int(popcntAndSlice(bc.bitmap, value2.bitmap))
 	if newcardinality > arrayDefaultMaxSize {
@@ -963,6 +1008,66 @@ func (bc *bitmapContainer) NextSetBit(i int) int {
 	return -1
 }
 
+// lazyIXOR computes the symmetric difference with a in place without
+// maintaining the cardinality, which must be repaired afterwards
+func (bc *bitmapContainer) lazyIXOR(a container) {
+	switch x := a.(type) {
+	case *arrayContainer:
+		for _, v := range x.content {
+			bc.bitmap[v>>6] ^= uint64(1) << (v % 64)
+		}
+	case *bitmapContainer:
+		for i, w := range x.bitmap {
+			bc.bitmap[i] ^= w
+		}
+	case *runContainer16:
+		for _, iv := range x.iv {
+			flipBitmapRange(bc.bitmap, int(iv.start), int(iv.last())+1)
+		}
+	}
+	bc.cardinality = invalidCardinality
+}
+
+// lazyIANDNOT removes the values of a in place without maintaining the
+// cardinality, which must be repaired afterwards
+func (bc *bitmapContainer) lazyIANDNOT(a container) {
+	switch x := a.(type) {
+	case *arrayContainer:
+		for _, v := range x.content {
+			bc.bitmap[v>>6] &^= uint64(1) << (v % 64)
+		}
+	case *bitmapContainer:
+		for i, w := range x.bitmap {
+			bc.bitmap[i] &^= w
+		}
+	case *runContainer16:
+		for _, iv := range x.iv {
+			resetBitmapRange(bc.bitmap, int(iv.start), int(iv.last())+1)
+		}
+	}
+	bc.cardinality = invalidCardinality
+}
+
+// nextClearBit returns the first position, starting at i, whose bit is
+// not set, or maxCapacity if there is none
+func (bc *bitmapContainer) nextClearBit(i int) int {
+	x := i / 64
+	if x >= len(bc.bitmap) {
+		return maxCapacity
+	}
+	w := ^bc.bitmap[x] >> uint(i%64)
+	if w != 0 {
+		return i + countTrailingZeros(w)
+	}
+	x++
+	for ; x < len(bc.bitmap); x++ {
+		if bc.bitmap[x] != ^uint64(0) {
+			return (x * 64) + countTrailingZeros(^bc.bitmap[x])
+		}
+	}
+	return maxCapacity
+}
+
 func (bc *bitmapContainer) PrevSetBit(i int) int {
 	if i < 0 {
 		return -1
@@ -1053,6 +1158,17 @@ func (bc *bitmapContainer) containerType() contype {
 	return bitmapContype
 }
 
+func (bc *bitmapContainer) validate() error {
+	card := int(popcntSlice(bc.bitmap))
+	if card != bc.cardinality {
+		return fmt.Errorf("bitmap container cardinality mismatch: header says %d, payload has %d", bc.cardinality, card)
+	}
+	if card <= arrayDefaultMaxSize {
+		return fmt.Errorf("bitmap container with cardinality %d, at most %d should be an array", card, arrayDefaultMaxSize)
+	}
+	return nil
+}
+
 func (bc *bitmapContainer) addOffset(x uint16) []container {
 	low := newBitmapContainer()
 	high := newBitmapContainer()
@@ -0,0 +1,360 @@
+// Package bsi implements a bit-sliced index on top of roaring bitmaps.
+//
+// A bit-sliced index (BSI) maps column IDs (uint32) to signed 64-bit
+// values. Bit i of every stored value is kept in its own roaring bitmap
+// (a "slice"), so that range predicates and aggregates can be evaluated
+// with a handful of bitmap operations instead of scanning the values.
+//
+// The algorithms follow P. O'Neil and D. Quass, "Improved Query
+// Performance with Variant Indexes", SIGMOD 1997, and
+// P. O'Neil, E. O'Neil, X. Chen, S. Revilak, "The Star Schema Benchmark
+// and Augmented Fact Table Indexing", TPCTC 2009.
+package bsi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/RoaringBitmap/roaring"
+)
+
+// BitCount is the number of slices of a BSI
+const BitCount = 64
+
+// signBit is xored into values so that the unsigned order of the
+// encoded values matches the signed order of the original ones
+const signBit = uint64(1) << 63
+
+// Operation identifies a comparison evaluated by CompareValue
+type Operation int
+
+const (
+	// EQ selects the columns whose value is equal to the predicate
+	EQ Operation = iota
+	// LT selects the columns whose value is less than the predicate
+	LT
+	// LE selects the columns whose value is less than or equal to the predicate
+	LE
+	// GT selects the columns whose value is greater than the predicate
+	GT
+	// GE selects the columns whose value is greater than or equal to the predicate
+	GE
+	// BETWEEN selects the columns whose value lies in [valueOrStart, end]
+	BETWEEN
+)
+
+// BSI is a bit-sliced index mapping uint32 column IDs to int64 values
+type BSI struct {
+	ebm    *roaring.Bitmap // existence bitmap: the columns having a value
+	slices [BitCount]*roaring.Bitmap
+}
+
+// NewBSI creates an empty bit-sliced index
+func NewBSI() *BSI {
+	b := &BSI{ebm: roaring.NewBitmap()}
+	for i := range b.slices {
+		b.slices[i] = roaring.NewBitmap()
+	}
+	return b
+}
+
+func encode(value int64) uint64 {
+	return uint64(value) ^ signBit
+}
+
+func decode(u uint64) int64 {
+	return int64(u ^ signBit)
+}
+
+// SetValue sets the value of the column with the given ID, replacing any
+// previous value
+func (b *BSI) SetValue(columnID uint32, value int64) {
+	u := encode(value)
+	for i := 0; i < BitCount; i++ {
+		if u&(uint64(1)<<uint(i)) != 0 {
+			b.slices[i].Add(columnID)
+		} else {
+			b.slices[i].Remove(columnID)
+		}
+	}
+	b.ebm.Add(columnID)
+}
+
+// GetValue returns the value of the column with the given ID, the second
+// result is false if the column has no value
+func (b *BSI) GetValue(columnID uint32) (int64, bool) {
+	if !b.ebm.Contains(columnID) {
+		return 0, false
+	}
+	u := uint64(0)
+	for i := 0; i < BitCount; i++ {
+		if b.slices[i].Contains(columnID) {
+			u |= uint64(1) << uint(i)
+		}
+	}
+	return decode(u), true
+}
+
+// RemoveValue removes the value of the column with the given ID
+func (b *BSI) RemoveValue(columnID uint32) {
+	if !b.ebm.CheckedRemove(columnID) {
+		return
+	}
+	for i := 0; i < BitCount; i++ {
+		b.slices[i].Remove(columnID)
+	}
+}
+
+// GetExistenceBitmap returns the columns having a value, the result must
+// not be modified
+func (b *BSI) GetExistenceBitmap() *roaring.Bitmap {
+	return b.ebm
+}
+
+// GetCardinality returns the number of columns having a value
+func (b *BSI) GetCardinality() uint64 {
+	return b.ebm.GetCardinality()
+}
+
+// RunOptimize attempts to further compress the slices using run containers
+func (b *BSI) RunOptimize() {
+	b.ebm.RunOptimize()
+	for i := range b.slices {
+		b.slices[i].RunOptimize()
+	}
+}
+
+// Clone returns a deep copy of the index
+func (b *BSI) Clone() *BSI {
+	c := &BSI{ebm: b.ebm.Clone()}
+	for i := range b.slices {
+		c.slices[i] = b.slices[i].Clone()
+	}
+	return c
+}
+
+// Equals returns true if both indexes hold the same values
+func (b *BSI) Equals(o *BSI) bool {
+	if !b.ebm.Equals(o.ebm) {
+		return false
+	}
+	for i := range b.slices {
+		if !b.slices[i].Equals(o.slices[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// candidates returns the columns of foundSet having a value, a nil
+// foundSet stands for all the columns of the index
+func (b *BSI) candidates(foundSet *roaring.Bitmap) *roaring.Bitmap {
+	if foundSet == nil {
+		return b.ebm.Clone()
+	}
+	return roaring.And(b.ebm, foundSet)
+}
+
+// compare splits the candidates in three sets: the columns whose value is
+// less than, equal to and greater than the given value
+func (b *BSI) compare(value int64, foundSet *roaring.Bitmap) (lt, eq, gt *roaring.Bitmap) {
+	u := encode(value)
+	lt = roaring.NewBitmap()
+	gt = roaring.NewBitmap()
+	eq = b.candidates(foundSet)
+	for i := BitCount - 1; i >= 0 && !eq.IsEmpty(); i-- {
+		if u&(uint64(1)<<uint(i)) != 0 {
+			lt.Or(roaring.AndNot(eq, b.slices[i]))
+			eq.And(b.slices[i])
+		} else {
+			gt.Or(roaring.And(eq, b.slices[i]))
+			eq.AndNot(b.slices[i])
+		}
+	}
+	return
+}
+
+// CompareValue returns the columns of foundSet whose value satisfies the
+// given operation; end is only used by BETWEEN, for which the range is
+// inclusive. A nil foundSet stands for all the columns of the index.
+func (b *BSI) CompareValue(op Operation, valueOrStart, end int64, foundSet *roaring.Bitmap) *roaring.Bitmap {
+	switch op {
+	case EQ:
+		_, eq, _ := b.compare(valueOrStart, foundSet)
+		return eq
+	case LT:
+		lt, _, _ := b.compare(valueOrStart, foundSet)
+		return lt
+	case LE:
+		lt, eq, _ := b.compare(valueOrStart, foundSet)
+		lt.Or(eq)
+		return lt
+	case GT:
+		_, _, gt := b.compare(valueOrStart, foundSet)
+		return gt
+	case GE:
+		_, eq, gt := b.compare(valueOrStart, foundSet)
+		gt.Or(eq)
+		return gt
+	case BETWEEN:
+		if valueOrStart > end {
+			return roaring.NewBitmap()
+		}
+		_, eq, gt := b.compare(valueOrStart, foundSet)
+		gt.Or(eq)
+		lt, eq, _ := b.compare(end, gt)
+		lt.Or(eq)
+		return lt
+	}
+	panic(fmt.Sprintf("bsi: unknown operation %d", op))
+}
+
+// Sum returns the sum of the values of the columns of foundSet together
+// with the number of columns that were summed. The sum wraps around on
+// overflow like regular int64 arithmetic. A nil foundSet stands for all the
+// columns of the index.
+func (b *BSI) Sum(foundSet *roaring.Bitmap) (sum int64, count uint64) {
+	cands := b.candidates(foundSet)
+	count = cands.GetCardinality()
+	u := uint64(0)
+	for i := 0; i < BitCount; i++ {
+		u += cands.AndCardinality(b.slices[i]) << uint(i)
+	}
+	// every encoded value carries an extra 2^63
+	u -= count * signBit
+	return int64(u), count
+}
+
+// extreme walks the slices from the most significant one, keeping at each
+// step the candidates having the bit set (max) or cleared (min)
+func (b *BSI) extreme(foundSet *roaring.Bitmap, max bool) (int64, bool) {
+	cands := b.candidates(foundSet)
+	if cands.IsEmpty() {
+		return 0, false
+	}
+	u := uint64(0)
+	for i := BitCount - 1; i >= 0; i-- {
+		var next *roaring.Bitmap
+		if max {
+			next = roaring.And(cands, b.slices[i])
+		} else {
+			next = roaring.AndNot(cands, b.slices[i])
+		}
+		if next.IsEmpty() {
+			if !max {
+				u |= uint64(1) << uint(i)
+			}
+			continue
+		}
+		if max {
+			u |= uint64(1) << uint(i)
+		}
+		cands = next
+	}
+	return decode(u), true
+}
+
+// Min returns the smallest value among the columns of foundSet, the second
+// result is false if none of them has a value. A nil foundSet stands for all
+// the columns of the index.
+func (b *BSI) Min(foundSet *roaring.Bitmap) (int64, bool) {
+	return b.extreme(foundSet, false)
+}
+
+// Max returns the largest value among the columns of foundSet, the second
+// result is false if none of them has a value. A nil foundSet stands for all
+// the columns of the index.
+func (b *BSI) Max(foundSet *roaring.Bitmap) (int64, bool) {
+	return b.extreme(foundSet, true)
+}
+
+// TopK returns the k columns of foundSet having the largest values. Ties
+// are broken in favour of the smallest column IDs. If fewer than k columns
+// have a value, all of them are returned. A nil foundSet stands for all the
+// columns of the index.
+func (b *BSI) TopK(k uint64, foundSet *roaring.Bitmap) *roaring.Bitmap {
+	g := roaring.NewBitmap() // columns known to be in the answer
+	e := b.candidates(foundSet)
+	if k == 0 {
+		return g
+	}
+	if e.GetCardinality() <= k {
+		return e
+	}
+	for i := BitCount - 1; i >= 0; i-- {
+		x := roaring.Or(g, roaring.And(e, b.slices[i]))
+		n := x.GetCardinality()
+		if n > k {
+			e.And(b.slices[i])
+		} else if n < k {
+			g = x
+			e.AndNot(b.slices[i])
+		} else {
+			e.And(b.slices[i])
+			break
+		}
+	}
+	// the columns left in e are tied, take the smallest IDs
+	missing := k - g.GetCardinality()
+	it := e.Iterator()
+	for ; missing > 0 && it.HasNext(); missing-- {
+		g.Add(it.Next())
+	}
+	return g
+}
+
+// WriteTo writes a serialized version of the index to stream: the
+// existence bitmap followed by the slices, from the least significant
+// one, each in the portable roaring format
+func (b *BSI) WriteTo(stream io.Writer) (int64, error) {
+	n, err := b.ebm.WriteTo(stream)
+	if err != nil {
+		return n, err
+	}
+	for i := range b.slices {
+		m, err := b.slices[i].WriteTo(stream)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom reads a serialized version of the index from stream
+func (b *BSI) ReadFrom(stream io.Reader) (int64, error) {
+	ebm := roaring.NewBitmap()
+	n, err := ebm.ReadFrom(stream)
+	if err != nil {
+		return n, err
+	}
+	var slices [BitCount]*roaring.Bitmap
+	for i := range slices {
+		slices[i] = roaring.NewBitmap()
+		m, err := slices[i].ReadFrom(stream)
+		n += m
+		if err != nil {
+			return n, fmt.Errorf("error reading slice %d: %s", i, err)
+		}
+	}
+	b.ebm = ebm
+	b.slices = slices
+	return n, nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface
+func (b *BSI) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := b.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface
+func (b *BSI) UnmarshalBinary(data []byte) error {
+	_, err := b.ReadFrom(bytes.NewReader(data))
+	return err
+}
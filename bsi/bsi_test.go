@@ -0,0 +1,188 @@
+package bsi
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomBSI(r *rand.Rand, n int) (*BSI, map[uint32]int64) {
+	b := NewBSI()
+	m := make(map[uint32]int64)
+	for i := 0; i < n; i++ {
+		col := uint32(r.Intn(3 * n))
+		v := int64(r.Intn(2000)) - 1000
+		b.SetValue(col, v)
+		m[col] = v
+	}
+	return b, m
+}
+
+func filter(m map[uint32]int64, found *roaring.Bitmap, pred func(int64) bool) *roaring.Bitmap {
+	answer := roaring.NewBitmap()
+	for col, v := range m {
+		if (found == nil || found.Contains(col)) && pred(v) {
+			answer.Add(col)
+		}
+	}
+	return answer
+}
+
+func TestBSISetGetValue(t *testing.T) {
+	b := NewBSI()
+	values := []int64{0, 1, -1, 42, math.MaxInt64, math.MinInt64}
+	for i, v := range values {
+		b.SetValue(uint32(i*1000), v)
+	}
+	for i, v := range values {
+		got, ok := b.GetValue(uint32(i * 1000))
+		assert.True(t, ok)
+		assert.Equal(t, v, got)
+	}
+	_, ok := b.GetValue(1)
+	assert.False(t, ok)
+
+	b.SetValue(0, -7)
+	got, _ := b.GetValue(0)
+	assert.EqualValues(t, -7, got)
+	assert.EqualValues(t, len(values), b.GetCardinality())
+
+	b.RemoveValue(0)
+	_, ok = b.GetValue(0)
+	assert.False(t, ok)
+	assert.EqualValues(t, len(values)-1, b.GetCardinality())
+}
+
+func TestBSICompareValue(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	b, m := randomBSI(r, 5000)
+	found := roaring.NewBitmap()
+	for i := 0; i < 5000; i++ {
+		found.Add(uint32(r.Intn(15000)))
+	}
+
+	for _, fs := range []*roaring.Bitmap{nil, found} {
+		for _, c := range []int64{-1001, -1000, -3, 0, 17, 999, 1000} {
+			assert.True(t, filter(m, fs, func(v int64) bool { return v == c }).Equals(b.CompareValue(EQ, c, 0, fs)))
+			assert.True(t, filter(m, fs, func(v int64) bool { return v < c }).Equals(b.CompareValue(LT, c, 0, fs)))
+			assert.True(t, filter(m, fs, func(v int64) bool { return v <= c }).Equals(b.CompareValue(LE, c, 0, fs)))
+			assert.True(t, filter(m, fs, func(v int64) bool { return v > c }).Equals(b.CompareValue(GT, c, 0, fs)))
+			assert.True(t, filter(m, fs, func(v int64) bool { return v >= c }).Equals(b.CompareValue(GE, c, 0, fs)))
+			e := c + 250
+			assert.True(t, filter(m, fs, func(v int64) bool { return v >= c && v <= e }).Equals(b.CompareValue(BETWEEN, c, e, fs)))
+		}
+	}
+	assert.True(t, b.CompareValue(BETWEEN, 10, -10, nil).IsEmpty())
+}
+
+func TestBSIAggregates(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	b, m := randomBSI(r, 3000)
+	found := roaring.NewBitmap()
+	for i := 0; i < 2000; i++ {
+		found.Add(uint32(r.Intn(9000)))
+	}
+
+	for _, fs := range []*roaring.Bitmap{nil, found} {
+		sum, count := int64(0), uint64(0)
+		min, max := int64(math.MaxInt64), int64(math.MinInt64)
+		for col, v := range m {
+			if fs != nil && !fs.Contains(col) {
+				continue
+			}
+			sum += v
+			count++
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		s, c := b.Sum(fs)
+		assert.Equal(t, sum, s)
+		assert.Equal(t, count, c)
+		got, ok := b.Min(fs)
+		assert.True(t, ok)
+		assert.Equal(t, min, got)
+		got, ok = b.Max(fs)
+		assert.True(t, ok)
+		assert.Equal(t, max, got)
+	}
+
+	_, ok := b.Min(roaring.BitmapOf(1 << 30))
+	assert.False(t, ok)
+	s, c := b.Sum(roaring.NewBitmap())
+	assert.EqualValues(t, 0, s)
+	assert.EqualValues(t, 0, c)
+}
+
+func TestBSITopK(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	b, m := randomBSI(r, 3000)
+
+	cols := make([]uint32, 0, len(m))
+	for col := range m {
+		cols = append(cols, col)
+	}
+	// largest values first, then smallest column IDs
+	sort.Slice(cols, func(i, j int) bool {
+		if m[cols[i]] != m[cols[j]] {
+			return m[cols[i]] > m[cols[j]]
+		}
+		return cols[i] < cols[j]
+	})
+
+	for _, k := range []int{0, 1, 10, 100, 1000, len(cols), len(cols) + 10} {
+		expected := roaring.NewBitmap()
+		for i := 0; i < k && i < len(cols); i++ {
+			expected.Add(cols[i])
+		}
+		assert.True(t, expected.Equals(b.TopK(uint64(k), nil)), "k=%d", k)
+	}
+
+	b = NewBSI()
+	for i := uint32(0); i < 10; i++ {
+		b.SetValue(i, 5)
+	}
+	b.SetValue(100, 6)
+	assert.True(t, roaring.BitmapOf(0, 1, 100).Equals(b.TopK(3, nil)))
+	assert.True(t, roaring.BitmapOf(3, 4).Equals(b.TopK(2, roaring.BitmapOf(3, 4, 5))))
+}
+
+func TestBSISerialization(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	b, _ := randomBSI(r, 4000)
+	b.RunOptimize()
+
+	buf := &bytes.Buffer{}
+	n, err := b.WriteTo(buf)
+	require.NoError(t, err)
+	assert.EqualValues(t, buf.Len(), n)
+
+	// the existence bitmap comes first, in the portable format
+	ebm := roaring.NewBitmap()
+	_, err = ebm.ReadFrom(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.True(t, ebm.Equals(b.GetExistenceBitmap()))
+
+	c := NewBSI()
+	m, err := c.ReadFrom(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, n, m)
+	assert.True(t, b.Equals(c))
+
+	data, err := b.MarshalBinary()
+	require.NoError(t, err)
+	d := NewBSI()
+	require.NoError(t, d.UnmarshalBinary(data))
+	assert.True(t, b.Equals(d))
+
+	assert.Error(t, d.UnmarshalBinary(data[:len(data)/2]))
+}
@@ -0,0 +1,128 @@
+package roaring
+
+import "fmt"
+
+// Builder constructs a bitmap from strictly increasing values. The values
+// of the current key are kept as runs and turned into the smallest of an
+// array, bitmap or run container once the key is complete, so that a bulk
+// load runs in linear time without converting containers or looking them
+// up.
+type Builder struct {
+	answer *Bitmap
+	key    int          // key of the values in runs
+	runs   []interval16 // values added for the current key
+	card   int          // number of values in runs
+	last   int64        // last value added, -1 if none
+}
+
+// NewBuilder creates an empty Builder
+func NewBuilder() *Builder {
+	return &Builder{answer: NewBitmap(), key: -1, last: -1}
+}
+
+// Add appends x to the bitmap, it panics unless x is larger than all the
+// values added so far
+func (b *Builder) Add(x uint32) {
+	if int64(x) <= b.last {
+		panic(fmt.Sprintf("Builder values must be strictly increasing, got %d after %d", x, b.last))
+	}
+	b.addRun(int(highbits(x)), lowbits(x), lowbits(x))
+}
+
+// AddMany appends the values of dat, which must be strictly increasing and
+// larger than all the values added so far
+func (b *Builder) AddMany(dat []uint32) {
+	for _, x := range dat {
+		b.Add(x)
+	}
+}
+
+// AddRange appends the integers in [rangeStart, rangeEnd), it panics unless
+// rangeStart is larger than all the values added so far. An empty range is
+// ignored.
+func (b *Builder) AddRange(rangeStart, rangeEnd uint64) {
+	if rangeStart >= rangeEnd {
+		return
+	}
+	if rangeEnd-1 > MaxUint32 {
+		panic("rangeEnd-1 > MaxUint32")
+	}
+	if int64(rangeStart) <= b.last {
+		panic(fmt.Sprintf("Builder values must be strictly increasing, got %d after %d", rangeStart, b.last))
+	}
+	for rangeStart < rangeEnd {
+		key := rangeStart >> 16
+		end := rangeEnd
+		if next := (key + 1) << 16; next < end {
+			end = next
+		}
+		b.addRun(int(key), uint16(rangeStart), uint16(end-1))
+		rangeStart = end
+	}
+}
+
+// addRun appends the values from start to last (included) of the
+// container with the given key
+func (b *Builder) addRun(key int, start, last uint16) {
+	if key != b.key {
+		b.flush()
+		b.key = key
+	}
+	n := len(b.runs)
+	if n > 0 && int(b.runs[n-1].last())+1 == int(start) {
+		b.runs[n-1].length = last - b.runs[n-1].start
+	} else {
+		b.runs = append(b.runs, newInterval16Range(start, last))
+	}
+	b.card += int(last-start) + 1
+	b.last = int64(key)<<16 | int64(last)
+}
+
+// flush appends the container of the current key to the bitmap, picking
+// the form the same way as toEfficientContainer
+func (b *Builder) flush() {
+	if len(b.runs) == 0 {
+		return
+	}
+	sizeAsRunContainer := runContainer16SerializedSizeInBytes(len(b.runs))
+	sizeAsBitmapContainer := bitmapContainerSizeInBytes()
+	sizeAsArrayContainer := arrayContainerSizeInBytes(b.card)
+
+	var c container
+	if sizeAsRunContainer <= minOfInt(sizeAsBitmapContainer, sizeAsArrayContainer) {
+		iv := make([]interval16, len(b.runs))
+		copy(iv, b.runs)
+		rc := newRunContainer16TakeOwnership(iv)
+		rc.card = int64(b.card)
+		c = rc
+	} else if b.card <= arrayDefaultMaxSize {
+		content := make([]uint16, 0, b.card)
+		for _, iv := range b.runs {
+			for v := int(iv.start); v <= int(iv.last()); v++ {
+				content = append(content, uint16(v))
+			}
+		}
+		c = &arrayContainer{content}
+	} else {
+		bc := newBitmapContainer()
+		for _, iv := range b.runs {
+			setBitmapRange(bc.bitmap, int(iv.start), int(iv.last())+1)
+		}
+		bc.cardinality = b.card
+		c = bc
+	}
+	b.answer.highlowcontainer.appendContainer(uint16(b.key), c, false)
+	b.runs = b.runs[:0]
+	b.card = 0
+}
+
+// Finish returns the bitmap holding the values added so far and resets the
+// Builder, which can then be used to build a new bitmap
+func (b *Builder) Finish() *Bitmap {
+	b.flush()
+	answer := b.answer
+	b.answer = NewBitmap()
+	b.key = -1
+	b.last = -1
+	return answer
+}
@@ -0,0 +1,57 @@
+package roaring
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(t *testing.T) {
+	r := rand.New(rand.NewSource(16))
+	b := NewBuilder()
+	for trial := 0; trial < 3; trial++ {
+		expected := NewBitmap()
+		x := uint64(r.Intn(100))
+		for x < 60<<16 {
+			switch r.Intn(4) {
+			case 0:
+				end := x + uint64(r.Intn(1<<11))
+				b.AddRange(x, end)
+				expected.AddRange(x, end)
+				x = end
+			case 1:
+				var dat []uint32
+				for i := 0; i < 100; i++ {
+					dat = append(dat, uint32(x))
+					x += uint64(1 + r.Intn(5))
+				}
+				b.AddMany(dat)
+				expected.AddMany(dat)
+			default:
+				b.Add(uint32(x))
+				expected.Add(uint32(x))
+			}
+			x += uint64(1 + r.Intn(40*(trial+1)))
+		}
+		answer := b.Finish()
+		expected.RunOptimize()
+		assert.True(t, expected.Equals(answer))
+		assert.Equal(t, expected.GetCardinality(), answer.GetCardinality())
+		assert.NoError(t, answer.highlowcontainer.validate())
+		for i, c := range answer.highlowcontainer.containers {
+			assert.IsType(t, expected.highlowcontainer.containers[i], c)
+		}
+	}
+
+	assert.True(t, b.Finish().IsEmpty())
+	b.AddRange(MaxUint32-2, MaxRange)
+	assert.True(t, BitmapOf(MaxUint32-2, MaxUint32-1, MaxUint32).Equals(b.Finish()))
+
+	b.Add(10)
+	assert.Panics(t, func() { b.Add(10) })
+	assert.Panics(t, func() { b.AddRange(5, 20) })
+	assert.Panics(t, func() { b.AddMany([]uint32{11, 11}) })
+	b.AddRange(30, 30)
+	assert.True(t, BitmapOf(10, 11).Equals(b.Finish()))
+}
@@ -0,0 +1,177 @@
+package roaring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The format written by WriteToChecksummed wraps the portable
+// serialization with CRC32C checksums. All the integers are little endian.
+//
+//	magic                 4 bytes, checksummedMagic
+//	version               1 byte, then 3 reserved bytes
+//	total length          uint64, of the whole envelope
+//	container count       uint32
+//	portable header size  uint32
+//	for each container    uint32 payload size, uint32 payload CRC32C
+//	header CRC32C         uint32, of all the above and the portable header
+//	portable header       cookie, descriptive header and offsets
+//	container payloads
+const (
+	checksummedMagic      = "RBCS"
+	checksummedVersion    = 1
+	checksummedHeaderSize = 24
+	// the largest portable header: cookie, is-run bitmap, descriptive and
+	// offset headers of 1<<16 containers
+	maxPortableHeaderSize = 4 + (1<<16)/8 + 8*(1<<16)
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// CorruptContainerError is returned by ReadFromChecksummed when the payload
+// of a container does not match its checksum
+type CorruptContainerError struct {
+	Index int    // index of the container in the bitmap
+	Key   uint16 // key of the container, its values share these 16 high bits
+}
+
+func (e *CorruptContainerError) Error() string {
+	return fmt.Sprintf("corrupt bitmap, checksum mismatch in container %d (key %d)", e.Index, e.Key)
+}
+
+// WriteToChecksummed writes the portable serialization of the bitmap (see
+// WriteTo) in an envelope holding a magic number, a format version, the
+// total length and CRC32C checksums of the headers and of each container,
+// so that ReadFromChecksummed detects corrupted data.
+func (rb *Bitmap) WriteToChecksummed(stream io.Writer) (int64, error) {
+	portable, err := rb.ToBytes()
+	if err != nil {
+		return 0, err
+	}
+	h, err := parseSerializedHeader(portable)
+	if err != nil {
+		return 0, err
+	}
+	headerSize := len(portable)
+	if h.size > 0 {
+		headerSize = h.offset(0)
+	}
+
+	header := make([]byte, checksummedHeaderSize+8*h.size+4)
+	copy(header, checksummedMagic)
+	header[4] = checksummedVersion
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(header)+len(portable)))
+	binary.LittleEndian.PutUint32(header[16:], uint32(h.size))
+	binary.LittleEndian.PutUint32(header[20:], uint32(headerSize))
+	for i := 0; i < h.size; i++ {
+		off := h.offset(i)
+		n, err := h.containerSize(i)
+		if err != nil {
+			return 0, err
+		}
+		entry := header[checksummedHeaderSize+8*i:]
+		binary.LittleEndian.PutUint32(entry, uint32(n))
+		binary.LittleEndian.PutUint32(entry[4:], crc32.Checksum(portable[off:off+n], castagnoliTable))
+	}
+	crc := crc32.Update(crc32.Checksum(header[:len(header)-4], castagnoliTable), castagnoliTable, portable[:headerSize])
+	binary.LittleEndian.PutUint32(header[len(header)-4:], crc)
+
+	n, err := stream.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := stream.Write(portable)
+	return int64(n + m), err
+}
+
+// ReadFromChecksummed reads a bitmap written by WriteToChecksummed and
+// checks it against its checksums. A corrupted container is reported with
+// a *CorruptContainerError, other errors mean that the headers are
+// corrupted or the data truncated.
+// On error, the bitmap is left empty.
+func (rb *Bitmap) ReadFromChecksummed(stream io.Reader) (p int64, err error) {
+	p, err = rb.readFromChecksummed(stream)
+	if err != nil {
+		rb.Clear()
+	}
+	return
+}
+
+func (rb *Bitmap) readFromChecksummed(stream io.Reader) (int64, error) {
+	header := make([]byte, checksummedHeaderSize)
+	if n, err := io.ReadFull(stream, header); err != nil {
+		return int64(n), fmt.Errorf("malformed checksummed bitmap, could not read header: %s", err)
+	}
+	if string(header[:4]) != checksummedMagic {
+		return checksummedHeaderSize, fmt.Errorf("malformed checksummed bitmap, did not find expected magic in header")
+	}
+	if header[4] != checksummedVersion {
+		return checksummedHeaderSize, fmt.Errorf("unsupported checksummed bitmap version %d", header[4])
+	}
+	total := binary.LittleEndian.Uint64(header[8:])
+	size := int(binary.LittleEndian.Uint32(header[16:]))
+	headerSize := int(binary.LittleEndian.Uint32(header[20:]))
+	// bound the sizes before allocating, the checksum is verified next
+	if size > maxCapacity || headerSize > maxPortableHeaderSize {
+		return checksummedHeaderSize, fmt.Errorf("corrupt checksummed bitmap header, %d containers with a header of %d bytes", size, headerSize)
+	}
+
+	rest := make([]byte, 8*size+4+headerSize)
+	n, err := io.ReadFull(stream, rest)
+	p := int64(checksummedHeaderSize + n)
+	if err != nil {
+		return p, fmt.Errorf("malformed checksummed bitmap, could not read header: %s", err)
+	}
+	table := rest[:8*size]
+	crc := crc32.Update(crc32.Checksum(header, castagnoliTable), castagnoliTable, table)
+	crc = crc32.Update(crc, castagnoliTable, rest[8*size+4:])
+	if crc != binary.LittleEndian.Uint32(rest[8*size:]) {
+		return p, fmt.Errorf("corrupt checksummed bitmap header, checksum mismatch")
+	}
+
+	length := uint64(checksummedHeaderSize + len(rest))
+	for i := 0; i < size; i++ {
+		length += uint64(binary.LittleEndian.Uint32(table[8*i:]))
+	}
+	if length != total {
+		return p, fmt.Errorf("corrupt checksummed bitmap header, length %d instead of %d", total, length)
+	}
+
+	portable := make([]byte, total-uint64(checksummedHeaderSize+8*size+4))
+	copy(portable, rest[8*size+4:])
+	m, err := io.ReadFull(stream, portable[headerSize:])
+	p += int64(m)
+	if err != nil {
+		return p, fmt.Errorf("malformed checksummed bitmap, could not read containers: %s", err)
+	}
+
+	// the keys are read from the descriptive header, which is checked, and
+	// the containers are checked before being parsed
+	descStart := 8
+	if headerSize >= 4 && binary.LittleEndian.Uint32(portable)&0x0000FFFF == serialCookie {
+		descStart = 4 + (size+7)/8
+	}
+	if headerSize < descStart+4*size {
+		return p, fmt.Errorf("malformed checksummed bitmap, header of %d bytes for %d containers", headerSize, size)
+	}
+	off := headerSize
+	for i := 0; i < size; i++ {
+		n := int(binary.LittleEndian.Uint32(table[8*i:]))
+		if crc32.Checksum(portable[off:off+n], castagnoliTable) != binary.LittleEndian.Uint32(table[8*i+4:]) {
+			key := binary.LittleEndian.Uint16(portable[descStart+4*i:])
+			return p, &CorruptContainerError{Index: i, Key: key}
+		}
+		off += n
+	}
+
+	// the buffer is private, the containers can refer to it
+	if _, err := rb.FromBuffer(portable); err != nil {
+		return p, err
+	}
+	if rb.highlowcontainer.size() != size {
+		return p, fmt.Errorf("malformed checksummed bitmap, %d containers instead of %d", rb.highlowcontainer.size(), size)
+	}
+	return p, nil
+}
@@ -0,0 +1,70 @@
+package roaring
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksummedSerialization(t *testing.T) {
+	for _, rb := range lazyTestBitmaps() {
+		var buf bytes.Buffer
+		n, err := rb.WriteToChecksummed(&buf)
+		require.NoError(t, err)
+		assert.EqualValues(t, buf.Len(), n)
+
+		newrb := BitmapOf(1, 2, 3)
+		p, err := newrb.ReadFromChecksummed(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, n, p)
+		assert.True(t, rb.Equals(newrb))
+	}
+}
+
+func TestChecksummedSerializationCorrupt(t *testing.T) {
+	for _, rb := range lazyTestBitmaps() {
+		var buf bytes.Buffer
+		_, err := rb.WriteToChecksummed(&buf)
+		require.NoError(t, err)
+		data := buf.Bytes()
+		portable, err := rb.ToBytes()
+		require.NoError(t, err)
+		h, err := parseSerializedHeader(portable)
+		require.NoError(t, err)
+		start := len(data) - len(portable)
+
+		// flip a bit in each container
+		for i := 0; i < h.size; i++ {
+			n, err := h.containerSize(i)
+			require.NoError(t, err)
+			corrupt := append([]byte(nil), data...)
+			corrupt[start+h.offset(i)+n/2] ^= 4
+			newrb := BitmapOf(1, 2, 3)
+			_, err = newrb.ReadFromChecksummed(bytes.NewReader(corrupt))
+			if assert.IsType(t, &CorruptContainerError{}, err) {
+				assert.Equal(t, &CorruptContainerError{Index: i, Key: h.key(i)}, err)
+			}
+			assert.True(t, newrb.IsEmpty())
+		}
+
+		// flip a bit in the headers
+		for _, pos := range []int{0, 4, 9, 17, 21, start - 1, start, start + 5} {
+			corrupt := append([]byte(nil), data...)
+			corrupt[pos] ^= 1
+			newrb := BitmapOf(1, 2, 3)
+			_, err = newrb.ReadFromChecksummed(bytes.NewReader(corrupt))
+			if assert.Error(t, err, "pos=%d", pos) {
+				assert.NotContains(t, err.Error(), "container ", "pos=%d", pos)
+			}
+			assert.True(t, newrb.IsEmpty())
+		}
+
+		for _, n := range []int{0, 10, start, len(data) - 1} {
+			newrb := NewBitmap()
+			_, err = newrb.ReadFromChecksummed(bytes.NewReader(data[:n]))
+			assert.Error(t, err, "n=%d", n)
+		}
+	}
+}
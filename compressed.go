@@ -0,0 +1,245 @@
+package roaring
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Codec compresses the portable serialization of a bitmap, see
+// WriteToCompressed. A codec must be registered with RegisterCodec to be
+// found by ReadFromCompressed.
+type Codec interface {
+	// ID identifies the codec in the envelope
+	ID() uint8
+	// NewWriter returns a writer compressing into w, which is closed once
+	// the bitmap is written
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader decompressing r
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// The envelope written by WriteToCompressed is made of compressedMagic,
+// the version, the codec ID, the uncompressed size and the compressed size
+// as little endian uint64, followed by the portable serialization
+// compressed by the codec. Recording the compressed size lets a reader
+// stop at the end of the envelope, so that it can be embedded in a larger
+// stream.
+const (
+	compressedMagic      = "RBZ"
+	compressedVersion    = 1
+	compressedHeaderSize = len(compressedMagic) + 2 + 8 + 8
+)
+
+var (
+	codecsMutex sync.RWMutex
+	codecs      = map[uint8]Codec{}
+)
+
+func init() {
+	RegisterCodec(IdentityCodec)
+	RegisterCodec(NewFlateCodec(flate.DefaultCompression))
+}
+
+// RegisterCodec makes a codec available to ReadFromCompressed, it panics
+// if another codec already uses its ID
+func RegisterCodec(c Codec) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+	if _, ok := codecs[c.ID()]; ok {
+		panic(fmt.Sprintf("roaring: codec ID %d registered twice", c.ID()))
+	}
+	codecs[c.ID()] = c
+}
+
+func lookupCodec(id uint8) (Codec, bool) {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	c, ok := codecs[id]
+	return c, ok
+}
+
+// IdentityCodec stores the portable serialization as is
+var IdentityCodec Codec = identityCodec{}
+
+type identityCodec struct{}
+
+func (identityCodec) ID() uint8 {
+	return 0
+}
+
+func (identityCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (identityCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return nopReadCloser{r}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type nopReadCloser struct {
+	io.Reader
+}
+
+func (nopReadCloser) Close() error {
+	return nil
+}
+
+type flateCodec struct {
+	level int
+}
+
+// NewFlateCodec returns a codec using compress/flate at the given level.
+// All the levels share the same ID since they decompress alike.
+func NewFlateCodec(level int) Codec {
+	return flateCodec{level}
+}
+
+func (flateCodec) ID() uint8 {
+	return 1
+}
+
+func (c flateCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, c.level)
+}
+
+func (flateCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// WriteToCompressed writes the portable serialization of the bitmap (see
+// WriteTo) compressed by codec, within an envelope recording the codec,
+// and returns the number of bytes written to stream. It replaces
+// WriteToMsgpack.
+func (rb *Bitmap) WriteToCompressed(stream io.Writer, codec Codec) (int64, error) {
+	// the compressed size is only known once the bitmap is compressed
+	var payload bytes.Buffer
+	w, err := codec.NewWriter(&payload)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := rb.WriteTo(w); err != nil {
+		w.Close()
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+
+	var header [compressedHeaderSize]byte
+	copy(header[:], compressedMagic)
+	header[len(compressedMagic)] = compressedVersion
+	header[len(compressedMagic)+1] = codec.ID()
+	binary.LittleEndian.PutUint64(header[len(compressedMagic)+2:], rb.GetSerializedSizeInBytes())
+	binary.LittleEndian.PutUint64(header[len(compressedMagic)+10:], uint64(payload.Len()))
+	n, err := stream.Write(header[:])
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := payload.WriteTo(stream)
+	return int64(n) + m, err
+}
+
+// UnwrapCompressed reads the envelope written by WriteToCompressed and
+// returns the portable serialization it holds, which any implementation
+// can then read. The result must be closed once read, stream is not read
+// past the end of the envelope.
+func UnwrapCompressed(stream io.Reader) (io.ReadCloser, error) {
+	r, _, _, err := openCompressed(stream)
+	return r, err
+}
+
+// openCompressed reads the envelope header and returns a reader
+// decompressing the payload, along with the payload itself, limited to
+// its recorded size, and the uncompressed size
+func openCompressed(stream io.Reader) (io.ReadCloser, *io.LimitedReader, uint64, error) {
+	var header [compressedHeaderSize]byte
+	if _, err := io.ReadFull(stream, header[:]); err != nil {
+		return nil, nil, 0, fmt.Errorf("malformed compressed bitmap, could not read envelope: %s", err)
+	}
+	if string(header[:len(compressedMagic)]) != compressedMagic {
+		return nil, nil, 0, fmt.Errorf("malformed compressed bitmap, did not find expected magic in envelope")
+	}
+	if v := header[len(compressedMagic)]; v != compressedVersion {
+		return nil, nil, 0, fmt.Errorf("unsupported compressed bitmap version %d", v)
+	}
+	id := header[len(compressedMagic)+1]
+	codec, ok := lookupCodec(id)
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("unknown codec ID %d in compressed bitmap", id)
+	}
+	compressedSize := binary.LittleEndian.Uint64(header[len(compressedMagic)+10:])
+	if compressedSize > 1<<62 {
+		return nil, nil, 0, fmt.Errorf("malformed compressed bitmap, invalid compressed size %d", compressedSize)
+	}
+	payload := &io.LimitedReader{R: stream, N: int64(compressedSize)}
+	r, err := codec.NewReader(payload)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return r, payload, binary.LittleEndian.Uint64(header[len(compressedMagic)+2:]), nil
+}
+
+// ReadFromCompressed reads a bitmap written by WriteToCompressed, with any
+// registered codec, and returns the number of bytes read from stream,
+// which is the size of the envelope: stream is not read past its end.
+// On error, the bitmap is left empty.
+func (rb *Bitmap) ReadFromCompressed(stream io.Reader) (p int64, err error) {
+	cr := &countingReader{r: stream}
+	r, payload, size, err := openCompressed(cr)
+	if err != nil {
+		rb.Clear()
+		return cr.n, err
+	}
+	n, err := rb.ReadFrom(r)
+	if err == nil && uint64(n) != size {
+		err = fmt.Errorf("malformed compressed bitmap, read %d bytes instead of %d", n, size)
+	}
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// the codec may leave some of the payload unread, such as a
+		// trailer, which still belongs to the envelope
+		if _, err = io.Copy(ioutil.Discard, payload); err == nil && payload.N > 0 {
+			err = fmt.Errorf("malformed compressed bitmap, payload truncated")
+		}
+	}
+	if err != nil {
+		rb.Clear()
+	}
+	return cr.n, err
+}
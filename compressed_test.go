@@ -0,0 +1,107 @@
+package roaring
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressedSerialization(t *testing.T) {
+	codecs := []Codec{IdentityCodec, NewFlateCodec(flate.BestSpeed), NewFlateCodec(flate.BestCompression)}
+	for _, rb := range lazyTestBitmaps() {
+		portable, err := rb.ToBytes()
+		require.NoError(t, err)
+		for _, codec := range codecs {
+			var buf bytes.Buffer
+			n, err := rb.WriteToCompressed(&buf, codec)
+			require.NoError(t, err)
+			assert.EqualValues(t, buf.Len(), n)
+			data := buf.Bytes()
+
+			newrb := BitmapOf(1, 2, 3)
+			_, err = newrb.ReadFromCompressed(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.True(t, rb.Equals(newrb))
+
+			r, err := UnwrapCompressed(bytes.NewReader(data))
+			require.NoError(t, err)
+			unwrapped, err := ioutil.ReadAll(r)
+			require.NoError(t, err)
+			assert.NoError(t, r.Close())
+			assert.Equal(t, portable, unwrapped)
+		}
+	}
+}
+
+func TestCompressedSerializationErrors(t *testing.T) {
+	rb := frozenTestBitmap()
+	var buf bytes.Buffer
+	_, err := rb.WriteToCompressed(&buf, NewFlateCodec(flate.DefaultCompression))
+	require.NoError(t, err)
+	data := buf.Bytes()
+
+	corrupt := func(i int, b byte) []byte {
+		c := append([]byte(nil), data...)
+		c[i] = b
+		return c
+	}
+	for _, bad := range [][]byte{
+		data[:5],
+		data[:len(data)/2],
+		corrupt(0, 'X'),
+		corrupt(3, compressedVersion+1),
+		corrupt(4, 255),
+		corrupt(5, data[5]+1),   // uncompressed size
+		corrupt(13, data[13]-1), // compressed size
+		corrupt(13, data[13]+1),
+	} {
+		newrb := BitmapOf(1, 2, 3)
+		_, err := newrb.ReadFromCompressed(bytes.NewReader(bad))
+		assert.Error(t, err)
+		assert.True(t, newrb.IsEmpty())
+	}
+
+	_, err = rb.WriteToCompressed(&buf, NewFlateCodec(42))
+	assert.Error(t, err)
+	assert.Panics(t, func() { RegisterCodec(NewFlateCodec(flate.BestSpeed)) })
+}
+
+func TestCompressedSerializationEmbedded(t *testing.T) {
+	bitmaps := lazyTestBitmaps()
+	var buf bytes.Buffer
+	var sizes []int64
+	for i, rb := range bitmaps {
+		n, err := rb.WriteToCompressed(&buf, NewFlateCodec(flate.DefaultCompression))
+		require.NoError(t, err)
+		sizes = append(sizes, n)
+		if i == 0 {
+			// a plain serialization in between
+			_, err = rb.WriteTo(&buf)
+			require.NoError(t, err)
+		}
+	}
+	data := buf.Bytes()
+
+	for _, r := range []io.Reader{bytes.NewReader(data), bufio.NewReader(bytes.NewReader(data))} {
+		for i, rb := range bitmaps {
+			newrb := NewBitmap()
+			n, err := newrb.ReadFromCompressed(r)
+			require.NoError(t, err)
+			assert.Equal(t, sizes[i], n)
+			assert.True(t, rb.Equals(newrb))
+			if i == 0 {
+				_, err = newrb.ReadFrom(r)
+				require.NoError(t, err)
+				assert.True(t, rb.Equals(newrb))
+			}
+		}
+		_, err := NewBitmap().ReadFromCompressed(r)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,202 @@
+package roaring
+
+import "sync"
+
+// concurrentShards is the number of shards of a ConcurrentBitmap, the keys
+// are striped across them: the container of key k is in shard
+// k%concurrentShards
+const concurrentShards = 256
+
+// ConcurrentBitmap is a bitmap safe for concurrent use. Its containers are
+// striped by key across shards, each holding a Bitmap behind its own lock,
+// so that writers working on different containers do not wait for each
+// other, unless their keys are a multiple of 256 apart. The queries
+// spanning all the shards, and Snapshot, lock all of them and see a
+// consistent state.
+type ConcurrentBitmap struct {
+	shards [concurrentShards]concurrentShard
+}
+
+type concurrentShard struct {
+	sync.RWMutex
+	rb Bitmap
+}
+
+// NewConcurrentBitmap creates a new empty ConcurrentBitmap
+func NewConcurrentBitmap() *ConcurrentBitmap {
+	return &ConcurrentBitmap{}
+}
+
+func (cb *ConcurrentBitmap) shard(x uint32) *concurrentShard {
+	return &cb.shards[highbits(x)%concurrentShards]
+}
+
+// Add the integer x to the bitmap
+func (cb *ConcurrentBitmap) Add(x uint32) {
+	s := cb.shard(x)
+	s.Lock()
+	s.rb.Add(x)
+	s.Unlock()
+}
+
+// CheckedAdd adds the integer x to the bitmap and return true if it was
+// added (false if the integer was already present)
+func (cb *ConcurrentBitmap) CheckedAdd(x uint32) bool {
+	s := cb.shard(x)
+	s.Lock()
+	defer s.Unlock()
+	return s.rb.CheckedAdd(x)
+}
+
+// AddMany adds all of the values in dat, locking each shard once per run
+// of consecutive values that fall in it
+func (cb *ConcurrentBitmap) AddMany(dat []uint32) {
+	for len(dat) > 0 {
+		s := cb.shard(dat[0])
+		n := 1
+		for n < len(dat) && cb.shard(dat[n]) == s {
+			n++
+		}
+		s.Lock()
+		s.rb.AddMany(dat[:n])
+		s.Unlock()
+		dat = dat[n:]
+	}
+}
+
+// AddRange adds the integers in [rangeStart, rangeEnd) to the bitmap
+func (cb *ConcurrentBitmap) AddRange(rangeStart, rangeEnd uint64) {
+	cb.forEachShardInRange(rangeStart, rangeEnd, func(s *concurrentShard, start, end uint64) {
+		s.rb.AddRange(start, end)
+	})
+}
+
+// Remove the integer x from the bitmap
+func (cb *ConcurrentBitmap) Remove(x uint32) {
+	s := cb.shard(x)
+	s.Lock()
+	s.rb.Remove(x)
+	s.Unlock()
+}
+
+// CheckedRemove removes the integer x from the bitmap and return true if
+// it was removed (false if the integer was not present)
+func (cb *ConcurrentBitmap) CheckedRemove(x uint32) bool {
+	s := cb.shard(x)
+	s.Lock()
+	defer s.Unlock()
+	return s.rb.CheckedRemove(x)
+}
+
+// RemoveRange removes the integers in [rangeStart, rangeEnd) from the
+// bitmap
+func (cb *ConcurrentBitmap) RemoveRange(rangeStart, rangeEnd uint64) {
+	cb.forEachShardInRange(rangeStart, rangeEnd, func(s *concurrentShard, start, end uint64) {
+		s.rb.RemoveRange(start, end)
+	})
+}
+
+// forEachShardInRange calls f, with the shard locked, on the part of
+// [rangeStart, rangeEnd) of each container it overlaps
+func (cb *ConcurrentBitmap) forEachShardInRange(rangeStart, rangeEnd uint64, f func(s *concurrentShard, start, end uint64)) {
+	if rangeEnd > MaxRange {
+		rangeEnd = MaxRange
+	}
+	for rangeStart < rangeEnd {
+		end := (rangeStart>>16 + 1) << 16
+		if end > rangeEnd {
+			end = rangeEnd
+		}
+		s := cb.shard(uint32(rangeStart))
+		s.Lock()
+		f(s, rangeStart, end)
+		s.Unlock()
+		rangeStart = end
+	}
+}
+
+// Contains returns true if the integer is contained in the bitmap
+func (cb *ConcurrentBitmap) Contains(x uint32) bool {
+	s := cb.shard(x)
+	s.RLock()
+	defer s.RUnlock()
+	return s.rb.Contains(x)
+}
+
+// rlockAll read-locks all the shards, always in the same order
+func (cb *ConcurrentBitmap) rlockAll() {
+	for i := range cb.shards {
+		cb.shards[i].RLock()
+	}
+}
+
+func (cb *ConcurrentBitmap) runlockAll() {
+	for i := range cb.shards {
+		cb.shards[i].RUnlock()
+	}
+}
+
+// GetCardinality returns the number of integers contained in the bitmap
+func (cb *ConcurrentBitmap) GetCardinality() uint64 {
+	cb.rlockAll()
+	defer cb.runlockAll()
+	size := uint64(0)
+	for i := range cb.shards {
+		size += cb.shards[i].rb.GetCardinality()
+	}
+	return size
+}
+
+// IsEmpty returns true if the bitmap is empty
+func (cb *ConcurrentBitmap) IsEmpty() bool {
+	cb.rlockAll()
+	defer cb.runlockAll()
+	for i := range cb.shards {
+		if !cb.shards[i].rb.IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshot returns a Bitmap holding the content of the bitmap at one point
+// in time. The containers are shared with copy-on-write, so that taking a
+// snapshot does not copy the data: the first change to a shared container,
+// either in the snapshot or in cb, copies it.
+func (cb *ConcurrentBitmap) Snapshot() *Bitmap {
+	// marking the containers as shared modifies the shards, so they are
+	// locked for writing, always in the same order
+	for i := range cb.shards {
+		cb.shards[i].Lock()
+	}
+	// the keys from block*concurrentShards come in the order of the shards
+	answer := NewBitmap()
+	var pos [concurrentShards]int
+	for block := 0; block < maxCapacity/concurrentShards; block++ {
+		for i := range cb.shards {
+			ra := &cb.shards[i].rb.highlowcontainer
+			j := pos[i]
+			if j < ra.size() && int(ra.getKeyAtIndex(j))/concurrentShards == block {
+				answer.highlowcontainer.appendContainer(ra.getKeyAtIndex(j), ra.getContainerAtIndex(j), true)
+				ra.setNeedsCopyOnWrite(j)
+				pos[i]++
+			}
+		}
+	}
+	for i := range cb.shards {
+		cb.shards[i].Unlock()
+	}
+	return answer
+}
+
+// Or computes the union of a snapshot of the bitmap and x, neither of
+// which is modified
+func (cb *ConcurrentBitmap) Or(x *Bitmap) *Bitmap {
+	return Or(cb.Snapshot(), x)
+}
+
+// And computes the intersection of a snapshot of the bitmap and x, neither
+// of which is modified
+func (cb *ConcurrentBitmap) And(x *Bitmap) *Bitmap {
+	return And(cb.Snapshot(), x)
+}
@@ -0,0 +1,159 @@
+package roaring
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentBitmap(t *testing.T) {
+	cb := NewConcurrentBitmap()
+	expected := NewBitmap()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			// each writer has its own containers, and they all share the
+			// last one
+			base := uint32(w) << 24
+			local := NewBitmap()
+			for i := 0; i < 5000; i++ {
+				x := base + uint32(r.Intn(1<<24))
+				switch r.Intn(4) {
+				case 0:
+					cb.Remove(x)
+					local.Remove(x)
+				case 1:
+					assert.Equal(t, local.CheckedAdd(x), cb.CheckedAdd(x))
+				default:
+					cb.Add(x)
+					local.Add(x)
+				}
+				assert.True(t, cb.Contains(x) == local.Contains(x))
+			}
+			cb.AddRange(uint64(base)+100, uint64(base)+1<<23)
+			local.AddRange(uint64(base)+100, uint64(base)+1<<23)
+			cb.RemoveRange(uint64(base)+1000, uint64(base)+2000)
+			local.RemoveRange(uint64(base)+1000, uint64(base)+2000)
+			values := []uint32{MaxUint32 - uint32(w), MaxUint32 - 100 - uint32(w)}
+			cb.AddMany(values)
+			local.AddMany(values)
+			assert.True(t, cb.CheckedRemove(values[1]))
+			local.Remove(values[1])
+			mu.Lock()
+			expected.Or(local)
+			mu.Unlock()
+		}(w)
+	}
+	wg.Wait()
+
+	assert.Equal(t, expected.GetCardinality(), cb.GetCardinality())
+	assert.True(t, expected.Equals(cb.Snapshot()))
+	assert.False(t, cb.IsEmpty())
+	assert.True(t, NewConcurrentBitmap().IsEmpty())
+
+	other := BitmapOf(1, 2, 3, 5<<24, MaxUint32)
+	other.AddRange(100, 200)
+	assert.True(t, Or(expected, other).Equals(cb.Or(other)))
+	assert.True(t, And(expected, other).Equals(cb.And(other)))
+}
+
+func TestConcurrentBitmapAdjacentContainers(t *testing.T) {
+	cb := NewConcurrentBitmap()
+	// adjacent containers do not share a lock
+	for k := uint32(0); k < 1<<16-1; k++ {
+		assert.True(t, cb.shard(k<<16) != cb.shard((k+1)<<16))
+	}
+	assert.True(t, cb.shard(0) == cb.shard(1<<16-1))
+
+	// writers interleaved on adjacent containers
+	const writers = 8
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for k := uint32(w); k < 4*concurrentShards; k += writers {
+				for i := uint32(0); i < 1000; i++ {
+					cb.Add(k<<16 | i*3)
+				}
+				cb.Remove(k << 16)
+				cb.AddRange(uint64(k)<<16+50000, uint64(k)<<16+60000)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	expected := NewBitmap()
+	for k := uint32(0); k < 4*concurrentShards; k++ {
+		for i := uint32(1); i < 1000; i++ {
+			expected.Add(k<<16 | i*3)
+		}
+		expected.AddRange(uint64(k)<<16+50000, uint64(k)<<16+60000)
+	}
+	snapshot := cb.Snapshot()
+	assert.True(t, expected.Equals(snapshot))
+	assert.NoError(t, snapshot.highlowcontainer.validate())
+	assert.Equal(t, expected.GetCardinality(), cb.GetCardinality())
+
+	// a range spanning many containers
+	cb.RemoveRange(1<<16+7, 300<<16)
+	expected.RemoveRange(1<<16+7, 300<<16)
+	assert.True(t, expected.Equals(cb.Snapshot()))
+}
+
+func TestConcurrentBitmapSnapshot(t *testing.T) {
+	cb := NewConcurrentBitmap()
+	cb.AddRange(0, 1<<20)
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// the writers leave the first container alone
+				x := 1<<16 + uint32(r.Intn(1<<26-1<<16))
+				if r.Intn(2) == 0 {
+					cb.Add(x)
+				} else {
+					cb.Remove(x)
+				}
+			}
+		}(w)
+	}
+
+	for i := 0; i < 20; i++ {
+		snapshot := cb.Snapshot()
+		copied := snapshot.Clone()
+		// the snapshot is not affected by later writes
+		for j := 0; j < 100; j++ {
+			cb.Add(uint32(j)<<16 | 1)
+		}
+		cb.RemoveRange(0, 1<<16)
+		assert.True(t, copied.Equals(snapshot))
+		// nor cb by changes to the snapshot
+		snapshot.AddRange(0, 1<<16)
+		snapshot.Add(MaxUint32)
+		assert.False(t, cb.Contains(MaxUint32))
+		assert.False(t, cb.Contains(2))
+		cb.GetCardinality()
+	}
+	close(done)
+	wg.Wait()
+
+	snapshot := cb.Snapshot()
+	assert.Equal(t, snapshot.GetCardinality(), cb.GetCardinality())
+	assert.True(t, snapshot.Equals(cb.Snapshot()))
+}
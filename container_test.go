@@ -293,3 +293,34 @@ func TestRoaringContainer(t *testing.T) {
 		assert.True(t, checkContent(c, s))
 	})
 }
+
+func TestContainerRangeQueries(t *testing.T) {
+	content := []uint16{0, 1, 2, 3, 63, 64, 65, 100, 1000, 1001, 1002, 1003, 4000, 65534, 65535}
+	present := make(map[uint]bool)
+	for _, v := range content {
+		present[uint(v)] = true
+	}
+	ranges := [][2]uint{
+		{0, 0}, {0, 1}, {0, 4}, {0, 5}, {1, 3}, {4, 63}, {63, 66}, {62, 66},
+		{64, 128}, {100, 101}, {101, 1000}, {1000, 1004}, {999, 1004},
+		{1004, 4000}, {65534, 65536}, {65535, 65536}, {0, 65536}, {5000, 65534},
+	}
+
+	ac := makeContainer(content).(*arrayContainer)
+	bc := ac.toBitmapContainer()
+	rc := newRunContainer16FromContainer(ac)
+	for _, c := range []container{ac, bc, rc} {
+		for _, r := range ranges {
+			card := 0
+			for x := r[0]; x < r[1]; x++ {
+				if present[x] {
+					card++
+				}
+			}
+			msg := fmt.Sprintf("%T [%d,%d)", c, r[0], r[1])
+			assert.Equal(t, card, c.getCardinalityInRange(r[0], r[1]), msg)
+			assert.Equal(t, card == int(r[1]-r[0]), c.containsRange(r[0], r[1]), msg)
+			assert.Equal(t, card > 0, c.intersectsRange(r[0], r[1]), msg)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package roaring
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONFormat selects how MarshalJSONFormat represents a bitmap
+type JSONFormat int
+
+const (
+	// JSONArray is an array of the values, e.g., [1,2,3,4,5,9]
+	JSONArray JSONFormat = iota
+	// JSONRanges is a string listing the ranges of consecutive values, as
+	// with MarshalText, e.g., "1-5,9"
+	JSONRanges
+	// JSONBase64 is a string holding the portable serialization in base64,
+	// as with ToBase64
+	JSONBase64
+)
+
+// MarshalJSON implements the json.Marshaler interface, as an array of the
+// values. Use JSONRangesBitmap or JSONBase64Bitmap for a more compact
+// representation.
+func (rb *Bitmap) MarshalJSON() ([]byte, error) {
+	return rb.MarshalJSONFormat(JSONArray)
+}
+
+// MarshalJSONFormat returns the JSON representation of the bitmap in the
+// given format
+func (rb *Bitmap) MarshalJSONFormat(format JSONFormat) ([]byte, error) {
+	switch format {
+	case JSONArray:
+		buf := make([]byte, 0, 2+11*rb.GetCardinality())
+		buf = append(buf, '[')
+		for i := rb.Iterator(); i.HasNext(); {
+			if len(buf) > 1 {
+				buf = append(buf, ',')
+			}
+			buf = strconv.AppendUint(buf, uint64(i.Next()), 10)
+		}
+		return append(buf, ']'), nil
+	case JSONRanges:
+		text, err := rb.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(string(text))
+	case JSONBase64:
+		str, err := rb.ToBase64()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(str)
+	}
+	return nil, fmt.Errorf("unknown JSON format %d", format)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, it accepts any
+// of the JSON formats. The strings holding base64 are told apart from the
+// ranges by their first character: both cookies of the portable format
+// encode to a leading 'O', whereas the ranges start with a digit. The
+// serialization is checked as with FromBufferValidated.
+func (rb *Bitmap) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '[' {
+		var values []uint32
+		if err := json.Unmarshal(data, &values); err != nil {
+			return err
+		}
+		rb.Clear()
+		rb.AddMany(values)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(str, base64CookiePrefix) {
+		return rb.UnmarshalText([]byte(str))
+	}
+	// the input is untrusted, and the decoded buffer is not shared
+	data, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		rb.Clear()
+		return err
+	}
+	_, err = rb.FromBufferValidated(data)
+	return err
+}
+
+// base64CookiePrefix is the first character of the base64 encoding of
+// the portable format, whose cookies both start with the byte 0x3A or 0x3B
+const base64CookiePrefix = "O"
+
+// JSONRangesBitmap is a Bitmap represented in JSON in the JSONRanges
+// format, e.g., as a struct field. Any format is accepted when reading.
+type JSONRangesBitmap Bitmap
+
+// MarshalJSON implements the json.Marshaler interface
+func (b *JSONRangesBitmap) MarshalJSON() ([]byte, error) {
+	return (*Bitmap)(b).MarshalJSONFormat(JSONRanges)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (b *JSONRangesBitmap) UnmarshalJSON(data []byte) error {
+	return (*Bitmap)(b).UnmarshalJSON(data)
+}
+
+// JSONBase64Bitmap is a Bitmap represented in JSON in the JSONBase64
+// format, e.g., as a struct field. Any format is accepted when reading.
+type JSONBase64Bitmap Bitmap
+
+// MarshalJSON implements the json.Marshaler interface
+func (b *JSONBase64Bitmap) MarshalJSON() ([]byte, error) {
+	return (*Bitmap)(b).MarshalJSONFormat(JSONBase64)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (b *JSONBase64Bitmap) UnmarshalJSON(data []byte) error {
+	return (*Bitmap)(b).UnmarshalJSON(data)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface, it lists
+// the ranges of consecutive values separated by commas, a range being
+// either a single value or its first and last values separated by a dash,
+// e.g., "1-5,9,100-200"
+func (rb *Bitmap) MarshalText() ([]byte, error) {
+	var buf []byte
+	for it := newIntervalIterator(rb); it.HasNext(); {
+		iv := it.Next()
+		if len(buf) > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendUint(buf, uint64(iv.Start), 10)
+		if iv.Last != iv.Start {
+			buf = append(buf, '-')
+			buf = strconv.AppendUint(buf, uint64(iv.Last), 10)
+		}
+	}
+	if buf == nil {
+		buf = []byte{}
+	}
+	return buf, nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface, reading
+// the format of MarshalText. The ranges may come in any order and overlap,
+// and spaces around values are ignored.
+// On error, the bitmap is left empty.
+func (rb *Bitmap) UnmarshalText(text []byte) error {
+	rb.Clear()
+	str := strings.TrimSpace(string(text))
+	if str == "" {
+		return nil
+	}
+	for _, r := range strings.Split(str, ",") {
+		iv, err := parseRange(r)
+		if err != nil {
+			rb.Clear()
+			return err
+		}
+		rb.AddRange(uint64(iv.Start), uint64(iv.Last)+1)
+	}
+	return nil
+}
+
+// parseRange parses a single value or a range such as "100-200"
+func parseRange(r string) (Interval, error) {
+	first, last := r, r
+	if i := strings.IndexByte(r, '-'); i >= 0 {
+		first, last = r[:i], r[i+1:]
+	}
+	start, err := strconv.ParseUint(strings.TrimSpace(first), 10, 32)
+	if err != nil {
+		return Interval{}, fmt.Errorf("invalid range %q: %s", r, err)
+	}
+	end, err := strconv.ParseUint(strings.TrimSpace(last), 10, 32)
+	if err != nil {
+		return Interval{}, fmt.Errorf("invalid range %q: %s", r, err)
+	}
+	if start > end {
+		return Interval{}, fmt.Errorf("invalid range %q: %d > %d", r, start, end)
+	}
+	return Interval{uint32(start), uint32(end)}, nil
+}
+
+// Value implements the driver.Valuer interface, storing the portable
+// serialization of the bitmap, or NULL for a nil bitmap
+func (rb *Bitmap) Value() (driver.Value, error) {
+	if rb == nil {
+		return nil, nil
+	}
+	return rb.ToBytes()
+}
+
+// Scan implements the sql.Scanner interface, it reads the portable
+// serialization from a []byte, as stored by Value, checking it as with
+// ReadFromValidated, and the format of MarshalText from a string. NULL
+// gives an empty bitmap.
+func (rb *Bitmap) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		rb.Clear()
+		return nil
+	case []byte:
+		// the driver may reuse the slice, so the data is copied
+		_, err := rb.ReadFromValidated(bytes.NewReader(v))
+		return err
+	case string:
+		return rb.UnmarshalText([]byte(v))
+	}
+	return fmt.Errorf("cannot scan %T into a Bitmap", src)
+}
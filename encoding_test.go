@@ -0,0 +1,155 @@
+package roaring
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ json.Marshaler           = (*Bitmap)(nil)
+	_ json.Unmarshaler         = (*Bitmap)(nil)
+	_ encoding.TextMarshaler   = (*Bitmap)(nil)
+	_ encoding.TextUnmarshaler = (*Bitmap)(nil)
+	_ driver.Valuer            = (*Bitmap)(nil)
+	_ sql.Scanner              = (*Bitmap)(nil)
+)
+
+func TestBitmapJSON(t *testing.T) {
+	rb := BitmapOf(9, MaxUint32)
+	rb.AddRange(1, 6)
+	rb.AddRange(100, 201)
+
+	data, err := json.Marshal(rb)
+	require.NoError(t, err)
+	assert.Equal(t, `[1,2,3,4,5,9,100,`, string(data[:17]))
+	data, err = rb.MarshalJSONFormat(JSONRanges)
+	require.NoError(t, err)
+	assert.Equal(t, `"1-5,9,100-200,4294967295"`, string(data))
+	_, err = rb.MarshalJSONFormat(JSONFormat(42))
+	assert.Error(t, err)
+
+	for _, format := range []JSONFormat{JSONArray, JSONRanges, JSONBase64} {
+		for _, b := range append(lazyTestBitmaps(), rb) {
+			data, err := b.MarshalJSONFormat(format)
+			require.NoError(t, err)
+			// as a field, to go through encoding/json
+			var v struct{ B *Bitmap }
+			require.NoError(t, json.Unmarshal([]byte(`{"B":`+string(data)+`}`), &v))
+			assert.True(t, b.Equals(v.B), "format %d", format)
+		}
+	}
+
+	empty, err := NewBitmap().MarshalJSONFormat(JSONArray)
+	require.NoError(t, err)
+	assert.Equal(t, "[]", string(empty))
+	empty, err = NewBitmap().MarshalJSONFormat(JSONRanges)
+	require.NoError(t, err)
+	assert.Equal(t, `""`, string(empty))
+
+	// the wrapper types select the format of a field
+	v := struct {
+		A *Bitmap
+		R *JSONRangesBitmap
+		B *JSONBase64Bitmap
+	}{rb, (*JSONRangesBitmap)(rb), (*JSONBase64Bitmap)(rb)}
+	data, err = json.Marshal(v)
+	require.NoError(t, err)
+	base64, err := rb.ToBase64()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"R":"1-5,9,100-200,4294967295","B":"`+base64+`"}`)
+	v.A, v.R, v.B = nil, nil, nil
+	require.NoError(t, json.Unmarshal(data, &v))
+	assert.True(t, rb.Equals(v.A))
+	assert.True(t, rb.Equals((*Bitmap)(v.R)))
+	assert.True(t, rb.Equals((*Bitmap)(v.B)))
+
+	// the base64 detection relies on the encoding of both cookies
+	for _, b := range []*Bitmap{NewBitmap(), rb, frozenTestBitmap()} {
+		str, err := b.ToBase64()
+		require.NoError(t, err)
+		assert.Equal(t, base64CookiePrefix, str[:1])
+	}
+
+	for _, bad := range []string{`{}`, `[-1]`, `"1-"`, `"OjA"`, `[1,"a"]`, `"a"`} {
+		newrb := BitmapOf(1)
+		assert.Error(t, newrb.UnmarshalJSON([]byte(bad)), bad)
+	}
+}
+
+func TestBitmapText(t *testing.T) {
+	rb := NewBitmap()
+	require.NoError(t, rb.UnmarshalText([]byte(" 100-200, 9,1 - 5,3-4,4294967295 ")))
+	expected := BitmapOf(9, MaxUint32)
+	expected.AddRange(1, 6)
+	expected.AddRange(100, 201)
+	assert.True(t, expected.Equals(rb))
+	text, err := rb.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, "1-5,9,100-200,4294967295", string(text))
+
+	require.NoError(t, rb.UnmarshalText(nil))
+	assert.True(t, rb.IsEmpty())
+
+	for _, bad := range []string{"1,,2", "5-1", "a", "1-2-3", "4294967296", "-1"} {
+		rb := BitmapOf(1)
+		assert.Error(t, rb.UnmarshalText([]byte(bad)), bad)
+		assert.True(t, rb.IsEmpty())
+	}
+}
+
+func TestBitmapSQL(t *testing.T) {
+	rb := frozenTestBitmap()
+	v, err := rb.Value()
+	require.NoError(t, err)
+	data := v.([]byte)
+
+	newrb := NewBitmap()
+	require.NoError(t, newrb.Scan(data))
+	// the driver may reuse its buffer
+	for i := range data {
+		data[i] = 0
+	}
+	assert.True(t, rb.Equals(newrb))
+
+	require.NoError(t, newrb.Scan("1-3,7"))
+	assert.Equal(t, []uint32{1, 2, 3, 7}, newrb.ToArray())
+	require.NoError(t, newrb.Scan(nil))
+	assert.True(t, newrb.IsEmpty())
+	assert.Error(t, newrb.Scan(42))
+	assert.Error(t, newrb.Scan([]byte{1, 2, 3}))
+
+	var nilrb *Bitmap
+	v, err = nilrb.Value()
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestBitmapEncodingInvalid(t *testing.T) {
+	for _, name := range []string{
+		"invalidrunoverlap", "invalidarrayunsorted", "invalidkeyorder",
+		"invalidarrayduplicate", "invalidbitmapcardinality", "invalidduplicatekey",
+		"invalidruncardinality", "invalidrunempty", "invalidrunoverflow",
+	} {
+		fname := "testdata/" + name + ".bin"
+		data, err := ioutil.ReadFile(fname)
+		require.NoError(t, err)
+
+		rb := BitmapOf(1)
+		js, err := json.Marshal(base64.StdEncoding.EncodeToString(data))
+		require.NoError(t, err)
+		assert.Error(t, rb.UnmarshalJSON(js), fname)
+		assert.True(t, rb.IsEmpty(), fname)
+
+		rb = BitmapOf(1)
+		assert.Error(t, rb.Scan(data), fname)
+		assert.True(t, rb.IsEmpty(), fname)
+	}
+}
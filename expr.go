@@ -0,0 +1,325 @@
+package roaring
+
+// Expr is a boolean expression over bitmaps, built with Operand, AndExpr,
+// OrExpr, XorExpr and AndNotExpr, and computed with Eval.
+//
+// Eval goes through the expression one 16-bit key at a time: for each key,
+// the containers of the operands are combined up the tree and only the
+// final container is kept, so that no intermediate bitmap is built. Keys
+// that cannot contribute are skipped, e.g., an AND only visits the keys
+// present in all of its operands.
+type Expr interface {
+	newEvaluator() exprEvaluator
+}
+
+// exprEvaluator walks an expression key by key. Both methods must be
+// called with non-decreasing keys.
+type exprEvaluator interface {
+	// nextKey returns the smallest key, at least min, for which the
+	// expression may be non-empty, or maxCapacity if there is none
+	nextKey(min int) int
+	// containerAt returns the container of the expression for key, or nil
+	// if it is empty; owned is false if the container belongs to an
+	// operand and must not be modified
+	containerAt(key uint16) (c container, owned bool)
+}
+
+type operandExpr struct {
+	bitmap *Bitmap
+}
+
+type andExpr struct {
+	children []Expr
+}
+
+type orExpr struct {
+	children []Expr
+}
+
+type xorExpr struct {
+	children []Expr
+}
+
+type andNotExpr struct {
+	base   Expr
+	others []Expr
+}
+
+// Operand returns an expression standing for the bitmap, which must not be
+// modified until the expression has been evaluated
+func Operand(rb *Bitmap) Expr {
+	return operandExpr{rb}
+}
+
+// AndExpr returns the intersection of the expressions
+func AndExpr(children ...Expr) Expr {
+	return andExpr{children}
+}
+
+// OrExpr returns the union of the expressions
+func OrExpr(children ...Expr) Expr {
+	return orExpr{children}
+}
+
+// XorExpr returns the symmetric difference of the expressions
+func XorExpr(children ...Expr) Expr {
+	return xorExpr{children}
+}
+
+// AndNotExpr returns the values of base found in none of the others
+func AndNotExpr(base Expr, others ...Expr) Expr {
+	return andNotExpr{base, others}
+}
+
+// Eval computes the expression and returns the result as a new bitmap
+func Eval(e Expr) *Bitmap {
+	answer := NewBitmap()
+	ev := e.newEvaluator()
+	for k := ev.nextKey(0); k < maxCapacity; k = ev.nextKey(k + 1) {
+		c, owned := ev.containerAt(uint16(k))
+		if c == nil {
+			continue
+		}
+		if !owned {
+			c = c.clone()
+		}
+		answer.highlowcontainer.appendContainer(uint16(k), c, false)
+	}
+	return answer
+}
+
+func newEvaluators(children []Expr) []exprEvaluator {
+	evs := make([]exprEvaluator, len(children))
+	for i, c := range children {
+		evs[i] = c.newEvaluator()
+	}
+	return evs
+}
+
+type operandEvaluator struct {
+	ra  *roaringArray
+	pos int
+}
+
+func (e operandExpr) newEvaluator() exprEvaluator {
+	return &operandEvaluator{ra: &e.bitmap.highlowcontainer}
+}
+
+func (ev *operandEvaluator) nextKey(min int) int {
+	if min > MaxUint16 {
+		return maxCapacity
+	}
+	if ev.pos < ev.ra.size() && int(ev.ra.getKeyAtIndex(ev.pos)) < min {
+		ev.pos = ev.ra.advanceUntil(uint16(min), ev.pos)
+	}
+	if ev.pos < ev.ra.size() {
+		return int(ev.ra.getKeyAtIndex(ev.pos))
+	}
+	return maxCapacity
+}
+
+func (ev *operandEvaluator) containerAt(key uint16) (container, bool) {
+	if ev.nextKey(int(key)) != int(key) {
+		return nil, false
+	}
+	return ev.ra.getContainerAtIndex(ev.pos), false
+}
+
+type andEvaluator struct {
+	children []exprEvaluator
+}
+
+func (e andExpr) newEvaluator() exprEvaluator {
+	if len(e.children) == 0 {
+		return emptyEvaluator{}
+	}
+	return &andEvaluator{newEvaluators(e.children)}
+}
+
+// nextKey leapfrogs over the children until they agree on a key
+func (ev *andEvaluator) nextKey(min int) int {
+	key := min
+	for agreed := 0; agreed < len(ev.children); {
+		for _, c := range ev.children {
+			k := c.nextKey(key)
+			if k >= maxCapacity {
+				return maxCapacity
+			}
+			if k > key {
+				key = k
+				agreed = 0
+			} else {
+				agreed++
+			}
+		}
+	}
+	return key
+}
+
+func (ev *andEvaluator) containerAt(key uint16) (container, bool) {
+	answer, owned := ev.children[0].containerAt(key)
+	for _, c := range ev.children[1:] {
+		if answer == nil {
+			return nil, false
+		}
+		other, _ := c.containerAt(key)
+		if other == nil {
+			return nil, false
+		}
+		if owned {
+			answer = answer.iand(other)
+		} else {
+			answer = answer.and(other)
+			owned = true
+		}
+		if answer.getCardinality() == 0 {
+			return nil, false
+		}
+	}
+	return answer, owned
+}
+
+// unionEvaluator holds what the or and xor evaluators share: the next
+// key is the smallest one among the children
+type unionEvaluator struct {
+	children []exprEvaluator
+	// the answer of the last call to nextKey, valid for any min from
+	// lastMin to lastKey
+	lastMin, lastKey int
+	containers       []container
+	owned            []bool
+}
+
+func newUnionEvaluator(children []Expr) unionEvaluator {
+	return unionEvaluator{children: newEvaluators(children), lastMin: -1, lastKey: -1}
+}
+
+func (ev *unionEvaluator) nextKey(min int) int {
+	if ev.lastMin <= min && min <= ev.lastKey {
+		return ev.lastKey
+	}
+	key := maxCapacity
+	for _, c := range ev.children {
+		if k := c.nextKey(min); k < key {
+			key = k
+		}
+	}
+	ev.lastMin, ev.lastKey = min, key
+	return key
+}
+
+// collect gathers the non-empty containers of the children for key
+func (ev *unionEvaluator) collect(key uint16) ([]container, []bool) {
+	ev.containers = ev.containers[:0]
+	ev.owned = ev.owned[:0]
+	for _, c := range ev.children {
+		if x, owned := c.containerAt(key); x != nil {
+			ev.containers = append(ev.containers, x)
+			ev.owned = append(ev.owned, owned)
+		}
+	}
+	return ev.containers, ev.owned
+}
+
+type orEvaluator struct {
+	unionEvaluator
+}
+
+func (e orExpr) newEvaluator() exprEvaluator {
+	return &orEvaluator{newUnionEvaluator(e.children)}
+}
+
+func (ev *orEvaluator) containerAt(key uint16) (container, bool) {
+	containers, owned := ev.collect(key)
+	switch len(containers) {
+	case 0:
+		return nil, false
+	case 1:
+		return containers[0], owned[0]
+	case 2:
+		return containers[0].or(containers[1]), true
+	}
+	answer := toBitmapContainer(containers[0])
+	if answer == containers[0] && !owned[0] {
+		answer = answer.clone()
+	}
+	for _, c := range containers[1:] {
+		answer = answer.lazyIOR(c)
+	}
+	return repairAfterLazy(answer), true
+}
+
+type xorEvaluator struct {
+	unionEvaluator
+}
+
+func (e xorExpr) newEvaluator() exprEvaluator {
+	return &xorEvaluator{newUnionEvaluator(e.children)}
+}
+
+func (ev *xorEvaluator) containerAt(key uint16) (container, bool) {
+	containers, owned := ev.collect(key)
+	switch len(containers) {
+	case 0:
+		return nil, false
+	case 1:
+		return containers[0], owned[0]
+	}
+	bc, ok := containers[0].(*bitmapContainer)
+	if !ok || !owned[0] {
+		bc = toWritableBitmapContainer(containers[0])
+	}
+	for _, c := range containers[1:] {
+		bc.lazyIXOR(c)
+	}
+	if answer := repairAfterLazyXor(bc); answer != nil {
+		return answer, true
+	}
+	return nil, false
+}
+
+type andNotEvaluator struct {
+	base   exprEvaluator
+	others []exprEvaluator
+}
+
+func (e andNotExpr) newEvaluator() exprEvaluator {
+	return &andNotEvaluator{e.base.newEvaluator(), newEvaluators(e.others)}
+}
+
+func (ev *andNotEvaluator) nextKey(min int) int {
+	return ev.base.nextKey(min)
+}
+
+func (ev *andNotEvaluator) containerAt(key uint16) (container, bool) {
+	answer, owned := ev.base.containerAt(key)
+	if answer == nil {
+		return nil, false
+	}
+	for _, c := range ev.others {
+		other, _ := c.containerAt(key)
+		if other == nil {
+			continue
+		}
+		if owned {
+			answer = answer.iandNot(other)
+		} else {
+			answer = answer.andNot(other)
+			owned = true
+		}
+		if answer.getCardinality() == 0 {
+			return nil, false
+		}
+	}
+	return answer, owned
+}
+
+type emptyEvaluator struct{}
+
+func (emptyEvaluator) nextKey(min int) int {
+	return maxCapacity
+}
+
+func (emptyEvaluator) containerAt(key uint16) (container, bool) {
+	return nil, false
+}
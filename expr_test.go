@@ -0,0 +1,102 @@
+package roaring
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// randomExpr builds a random expression over the bitmaps together with its
+// value computed with the regular operations
+func randomExpr(r *rand.Rand, bitmaps []*Bitmap, depth int) (Expr, *Bitmap) {
+	if depth == 0 || r.Intn(4) == 0 {
+		b := bitmaps[r.Intn(len(bitmaps))]
+		return Operand(b), b.Clone()
+	}
+	n := 1 + r.Intn(4)
+	children := make([]Expr, n)
+	values := make([]*Bitmap, n)
+	for i := range children {
+		children[i], values[i] = randomExpr(r, bitmaps, depth-1)
+	}
+	answer := values[0].Clone()
+	switch r.Intn(4) {
+	case 0:
+		for _, v := range values[1:] {
+			answer.And(v)
+		}
+		return AndExpr(children...), answer
+	case 1:
+		for _, v := range values[1:] {
+			answer.Or(v)
+		}
+		return OrExpr(children...), answer
+	case 2:
+		for _, v := range values[1:] {
+			answer.Xor(v)
+		}
+		return XorExpr(children...), answer
+	default:
+		for _, v := range values[1:] {
+			answer.AndNot(v)
+		}
+		return AndNotExpr(children[0], children[1:]...), answer
+	}
+}
+
+func TestExprEval(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	bitmaps := randomAggregationInputs(r, 6)
+	// sparse bitmaps exercise the skipping of keys
+	for i := 0; i < 3; i++ {
+		rb := NewBitmap()
+		for j := 0; j < 20; j++ {
+			rb.Add(uint32(r.Intn(1 << 30)))
+		}
+		bitmaps = append(bitmaps, rb)
+	}
+	bitmaps = append(bitmaps, NewBitmap(), FromIntervals(Interval{0, 40<<16 - 1}, Interval{MaxUint32 - 5, MaxUint32}))
+
+	var clones []*Bitmap
+	for _, b := range bitmaps {
+		clones = append(clones, b.Clone())
+	}
+
+	for trial := 0; trial < 300; trial++ {
+		e, expected := randomExpr(r, bitmaps, 4)
+		answer := Eval(e)
+		assert.True(t, expected.Equals(answer), "trial %d", trial)
+		assert.Equal(t, expected.GetCardinality(), answer.GetCardinality(), "trial %d", trial)
+		for i, c := range answer.highlowcontainer.containers {
+			assert.True(t, c.getCardinality() > 0)
+			assert.Equal(t, expected.highlowcontainer.keys[i], answer.highlowcontainer.keys[i])
+		}
+	}
+
+	for i, b := range bitmaps {
+		assert.True(t, clones[i].Equals(b))
+	}
+}
+
+func TestExprEvalSimple(t *testing.T) {
+	a := BitmapOf(1, 2, 3, 1<<16, 5<<16)
+	b := BitmapOf(2, 3, 4, 5<<16)
+	c := BitmapOf(3, 1<<20)
+	d := BitmapOf(5<<16, 1<<20)
+
+	// (a OR b) AND NOT (c OR d)
+	e := AndNotExpr(OrExpr(Operand(a), Operand(b)), OrExpr(Operand(c), Operand(d)))
+	assert.True(t, BitmapOf(1, 2, 4, 1<<16).Equals(Eval(e)))
+
+	assert.True(t, BitmapOf(2, 3, 5<<16).Equals(Eval(AndExpr(Operand(a), Operand(b)))))
+	assert.True(t, BitmapOf(1, 4, 1<<16).Equals(Eval(XorExpr(Operand(a), Operand(b)))))
+	assert.True(t, Eval(AndExpr()).IsEmpty())
+	assert.True(t, Eval(OrExpr()).IsEmpty())
+	assert.True(t, Eval(XorExpr(Operand(a), Operand(a))).IsEmpty())
+
+	// the result must not share containers with the operands
+	res := Eval(Operand(a))
+	res.Add(100)
+	assert.False(t, a.Contains(100))
+}
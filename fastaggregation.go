@@ -63,6 +63,7 @@ main:
 
 // In-place Or function that requires repairAfterLazy
 func (x1 *Bitmap) lazyOR(x2 *Bitmap) *Bitmap {
+	x1.highlowcontainer.invalidateRankIndex()
 	pos1 := 0
 	pos2 := 0
 	length1 := x1.highlowcontainer.size()
@@ -171,6 +172,77 @@ func FastOr(bitmaps ...*Bitmap) *Bitmap {
 	return answer
 }
 
+// OrAccumulator computes the union of bitmaps added one at a time, as they
+// become available. Like FastOr, it keeps the intermediate containers in
+// bitmap form without maintaining their cardinality, which is only
+// computed once, by Result.
+//
+// The zero value is an empty accumulator ready to use. An OrAccumulator
+// is not safe for concurrent use.
+type OrAccumulator struct {
+	answer *Bitmap
+}
+
+// NewOrAccumulator creates an empty OrAccumulator
+func NewOrAccumulator() *OrAccumulator {
+	return &OrAccumulator{}
+}
+
+// Add includes the bitmap in the union. The accumulator does not keep a
+// reference to x, which can be modified or discarded after the call.
+func (acc *OrAccumulator) Add(x *Bitmap) {
+	if acc.answer == nil {
+		acc.answer = NewBitmap()
+	}
+	acc.answer.lazyOR(x)
+}
+
+// Result returns the union of the bitmaps added so far and resets the
+// accumulator
+func (acc *OrAccumulator) Result() *Bitmap {
+	answer := acc.answer
+	acc.answer = nil
+	if answer == nil {
+		return NewBitmap()
+	}
+	answer.repairAfterLazy()
+	return answer
+}
+
+// FastXor computes the symmetric difference between many bitmaps quickly,
+// as opposed to having to call Xor repeatedly. The containers sharing a
+// key are combined all at once, without intermediate bitmaps.
+func FastXor(bitmaps ...*Bitmap) *Bitmap {
+	if len(bitmaps) == 0 {
+		return NewBitmap()
+	} else if len(bitmaps) == 1 {
+		return bitmaps[0].Clone()
+	}
+	return &Bitmap{*xorOnRange(bitmaps, 0, MaxUint16)}
+}
+
+// FastAndNot computes the difference between base and the union of the
+// other bitmaps quickly, as opposed to having to call AndNot repeatedly
+func FastAndNot(base *Bitmap, others ...*Bitmap) *Bitmap {
+	if len(others) == 0 {
+		return base.Clone()
+	}
+	return &Bitmap{*andNotOnRange(base, others, 0, MaxUint16)}
+}
+
+// Threshold computes the values present in at least k of the bitmaps.
+// The containers sharing a key are counted all at once with bit-sliced
+// counters. A k smaller than 1 is treated as 1.
+func Threshold(k int, bitmaps ...*Bitmap) *Bitmap {
+	if k < 1 {
+		k = 1
+	}
+	if k > len(bitmaps) {
+		return NewBitmap()
+	}
+	return &Bitmap{*thresholdOnRange(k, bitmaps, 0, MaxUint16)}
+}
+
 // HeapOr computes the union between many bitmaps quickly using a heap.
 // It might be faster than calling Or repeatedly.
 func HeapOr(bitmaps ...*Bitmap) *Bitmap {
@@ -5,6 +5,7 @@ package roaring
 import (
 	"container/heap"
 	"github.com/stretchr/testify/assert"
+	"math/rand"
 	"testing"
 )
 
@@ -191,3 +192,69 @@ func TestFastAggregationsXOR_run(t *testing.T) {
 
 	assert.True(t, HeapXor(rb1, rb2, rb3).Equals(bigxor))
 }
+
+func TestFastAggregationsOrAccumulator(t *testing.T) {
+	r := rand.New(rand.NewSource(8))
+	var bitmaps []*Bitmap
+	for i := 0; i < 20; i++ {
+		rb := NewBitmap()
+		for j := 0; j < 5000; j++ {
+			rb.Add(uint32(r.Intn(1 << 20)))
+		}
+		start := uint64(r.Intn(1 << 20))
+		rb.AddRange(start, start+uint64(r.Intn(1<<17)))
+		if i%3 == 0 {
+			rb.RunOptimize()
+		}
+		if i%5 == 0 {
+			buf, err := rb.ToBytes()
+			assert.NoError(t, err)
+			rb = NewBitmap()
+			_, err = rb.FromBuffer(buf)
+			assert.NoError(t, err)
+		}
+		bitmaps = append(bitmaps, rb)
+	}
+	expected := NewBitmap()
+	for _, rb := range bitmaps {
+		expected.Or(rb)
+	}
+
+	var clones []*Bitmap
+	acc := NewOrAccumulator()
+	for _, rb := range bitmaps {
+		clones = append(clones, rb.Clone())
+		acc.Add(rb)
+	}
+	// the accumulator must not depend on the added bitmaps
+	for _, rb := range bitmaps {
+		rb.AddRange(0, 1<<16)
+	}
+	answer := acc.Result()
+	assert.True(t, expected.Equals(answer))
+	assert.Equal(t, expected.GetCardinality(), answer.GetCardinality())
+	for i, c := range answer.highlowcontainer.containers {
+		assert.Equal(t, expected.highlowcontainer.containers[i].getCardinality(), c.getCardinality())
+		if bc, ok := c.(*bitmapContainer); ok {
+			assert.True(t, bc.cardinality > arrayDefaultMaxSize)
+		}
+	}
+
+	// Result resets the accumulator
+	assert.True(t, acc.Result().IsEmpty())
+	acc.Add(clones[0])
+	assert.True(t, clones[0].Equals(acc.Result()))
+
+	var zero OrAccumulator
+	zero.Add(BitmapOf(1, 2))
+	zero.Add(BitmapOf(2, 3))
+	assert.True(t, BitmapOf(1, 2, 3).Equals(zero.Result()))
+
+	// a full container is turned into a run
+	acc.Add(FromIntervals(Interval{0, 40000}))
+	acc.Add(FromIntervals(Interval{30000, 70000}))
+	full := acc.Result()
+	assert.EqualValues(t, 70001, full.GetCardinality())
+	_, isRun := full.highlowcontainer.containers[0].(*runContainer16)
+	assert.True(t, isRun)
+}
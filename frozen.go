@@ -0,0 +1,451 @@
+package roaring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The frozen format is the layout written by CRoaring's
+// roaring_bitmap_frozen_serialize. It mirrors the in-memory layout of a
+// bitmap so that it can be used in place, without any per-container
+// allocation. From the start of the buffer:
+//
+//	bitset containers  8192 bytes each
+//	run containers     4 bytes per run (start, length)
+//	array containers   2 bytes per value
+//	keys               2 bytes per container
+//	counts             2 bytes per container (cardinality-1, or number of runs)
+//	typecodes          1 byte per container
+//	header             4 bytes: frozenCookie | numContainers<<15
+//
+// All integers are little endian.
+const (
+	frozenCookie = 13766
+
+	frozenBitsetType = 1
+	frozenArrayType  = 2
+	frozenRunType    = 3
+
+	frozenBitsetSizeInBytes = 1 << 13
+)
+
+// GetFrozenSizeInBytes computes the number of bytes needed to freeze
+// the bitmap (see Freeze)
+func (rb *Bitmap) GetFrozenSizeInBytes() uint64 {
+	ra := &rb.highlowcontainer
+	size := uint64(4 + 5*len(ra.keys))
+	for _, c := range ra.containers {
+		switch x := c.(type) {
+		case *arrayContainer:
+			size += 2 * uint64(len(x.content))
+		case *bitmapContainer:
+			size += frozenBitsetSizeInBytes
+		case *runContainer16:
+			size += 4 * uint64(len(x.iv))
+		}
+	}
+	return size
+}
+
+// Freeze serializes the bitmap in the frozen format, which is compatible
+// with CRoaring's roaring_bitmap_frozen_serialize and can be used in place
+// with FrozenView.
+func (rb *Bitmap) Freeze() ([]byte, error) {
+	buf := make([]byte, rb.GetFrozenSizeInBytes())
+	if _, err := rb.FreezeTo(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// FreezeTo serializes the bitmap in the frozen format into buf and returns
+// the number of bytes written. The buffer must hold at least
+// GetFrozenSizeInBytes bytes.
+//
+// CRoaring requires frozen buffers to be 32-byte aligned; on platforms
+// where the bitmap is used in place (386, amd64), buf should at least be
+// 8-byte aligned.
+func (rb *Bitmap) FreezeTo(buf []byte) (int, error) {
+	ra := &rb.highlowcontainer
+	size := rb.GetFrozenSizeInBytes()
+	if uint64(len(buf)) < size {
+		return 0, fmt.Errorf("buffer too small for frozen bitmap: %d bytes, need %d", len(buf), size)
+	}
+	n := len(ra.keys)
+
+	var bitsetZone, runZone, arrayZone int
+	for _, c := range ra.containers {
+		switch x := c.(type) {
+		case *arrayContainer:
+			arrayZone += 2 * len(x.content)
+		case *bitmapContainer:
+			bitsetZone += frozenBitsetSizeInBytes
+		case *runContainer16:
+			runZone += 4 * len(x.iv)
+		}
+	}
+
+	bitsetPos := 0
+	runPos := bitsetZone
+	arrayPos := runPos + runZone
+	keyPos := arrayPos + arrayZone
+	countPos := keyPos + 2*n
+	typePos := countPos + 2*n
+
+	for i, c := range ra.containers {
+		binary.LittleEndian.PutUint16(buf[keyPos+2*i:], ra.keys[i])
+		var count uint16
+		switch x := c.(type) {
+		case *arrayContainer:
+			copy(buf[arrayPos:], uint16SliceAsByteSlice(x.content))
+			arrayPos += 2 * len(x.content)
+			count = uint16(len(x.content) - 1)
+			buf[typePos+i] = frozenArrayType
+		case *bitmapContainer:
+			copy(buf[bitsetPos:bitsetPos+frozenBitsetSizeInBytes], uint64SliceAsByteSlice(x.bitmap))
+			bitsetPos += frozenBitsetSizeInBytes
+			count = uint16(x.getCardinality() - 1)
+			buf[typePos+i] = frozenBitsetType
+		case *runContainer16:
+			for _, iv := range x.iv {
+				binary.LittleEndian.PutUint16(buf[runPos:], iv.start)
+				binary.LittleEndian.PutUint16(buf[runPos+2:], iv.length)
+				runPos += 4
+			}
+			count = uint16(len(x.iv))
+			buf[typePos+i] = frozenRunType
+		default:
+			return 0, errors.New("unsupported container type")
+		}
+		binary.LittleEndian.PutUint16(buf[countPos+2*i:], count)
+	}
+	binary.LittleEndian.PutUint32(buf[typePos+n:], uint32(n)<<15|frozenCookie)
+	return int(size), nil
+}
+
+// FrozenBitmap is a read-only bitmap backed by a buffer in the frozen
+// format (see Bitmap.Freeze). Queries run directly against the buffer:
+// viewing a buffer allocates a fixed number of slices whatever the number
+// of containers, and Contains or iteration do not allocate at all.
+//
+// The buffer must not be modified while the FrozenBitmap is in use.
+type FrozenBitmap struct {
+	keys      []uint16
+	counts    []uint16
+	typecodes []byte
+	bitsets   []uint64
+	runs      []interval16
+	arrays    []uint16
+	// offsets[i] is the position of container i within its zone, in
+	// words for bitsets, runs for run containers and values for arrays
+	offsets []uint32
+}
+
+// FrozenView returns a FrozenBitmap backed by buf, which must hold a
+// bitmap in the frozen format, such as written by Bitmap.Freeze or by
+// CRoaring's roaring_bitmap_frozen_serialize.
+func FrozenView(buf []byte) (*FrozenBitmap, error) {
+	fb := &FrozenBitmap{}
+	if err := fb.View(buf); err != nil {
+		return nil, err
+	}
+	return fb, nil
+}
+
+// View makes the FrozenBitmap point at buf, reusing its internal storage
+// when possible (see FrozenView)
+func (fb *FrozenBitmap) View(buf []byte) error {
+	if len(buf) < 4 {
+		return fmt.Errorf("frozen bitmap too short: %d bytes", len(buf))
+	}
+	header := binary.LittleEndian.Uint32(buf[len(buf)-4:])
+	if header&0x7FFF != frozenCookie {
+		return fmt.Errorf("invalid frozen cookie: %d", header&0x7FFF)
+	}
+	n := int(header >> 15)
+	if n > MaxUint16+1 {
+		return fmt.Errorf("too many containers in frozen bitmap: %d", n)
+	}
+	if len(buf) < 4+5*n {
+		return fmt.Errorf("frozen bitmap too short for %d containers: %d bytes", n, len(buf))
+	}
+	typePos := len(buf) - 4 - n
+	countPos := typePos - 2*n
+	keyPos := countPos - 2*n
+	typecodes := buf[typePos : typePos+n]
+	counts := byteSliceAsUint16Slice(buf[countPos:typePos])
+
+	if cap(fb.offsets) >= n {
+		fb.offsets = fb.offsets[:n]
+	} else {
+		fb.offsets = make([]uint32, n)
+	}
+	var bitsetZone, runZone, arrayZone int
+	for i := 0; i < n; i++ {
+		switch typecodes[i] {
+		case frozenBitsetType:
+			fb.offsets[i] = uint32(bitsetZone / 8)
+			bitsetZone += frozenBitsetSizeInBytes
+		case frozenArrayType:
+			fb.offsets[i] = uint32(arrayZone / 2)
+			arrayZone += 2 * (int(counts[i]) + 1)
+		case frozenRunType:
+			fb.offsets[i] = uint32(runZone / 4)
+			runZone += 4 * int(counts[i])
+		default:
+			return fmt.Errorf("invalid type code %d for container %d", typecodes[i], i)
+		}
+	}
+	if bitsetZone+runZone+arrayZone != keyPos {
+		return fmt.Errorf("frozen bitmap size mismatch: expected %d bytes, got %d", bitsetZone+runZone+arrayZone+5*n+4, len(buf))
+	}
+
+	fb.keys = byteSliceAsUint16Slice(buf[keyPos:countPos])
+	fb.counts = counts
+	fb.typecodes = typecodes
+	fb.bitsets = byteSliceAsUint64Slice(buf[:bitsetZone])
+	fb.runs = byteSliceAsInterval16Slice(buf[bitsetZone : bitsetZone+runZone])
+	fb.arrays = byteSliceAsUint16Slice(buf[bitsetZone+runZone : keyPos])
+	return nil
+}
+
+func (fb *FrozenBitmap) bitsetAt(i int) []uint64 {
+	start := fb.offsets[i]
+	return fb.bitsets[start : start+frozenBitsetSizeInBytes/8]
+}
+
+func (fb *FrozenBitmap) runsAt(i int) []interval16 {
+	start := fb.offsets[i]
+	return fb.runs[start : start+uint32(fb.counts[i])]
+}
+
+func (fb *FrozenBitmap) arrayAt(i int) []uint16 {
+	start := fb.offsets[i]
+	return fb.arrays[start : start+uint32(fb.counts[i])+1]
+}
+
+// containerAtIndex returns a container backed by the frozen buffer, it
+// must not be modified
+func (fb *FrozenBitmap) containerAtIndex(i int) container {
+	switch fb.typecodes[i] {
+	case frozenBitsetType:
+		return &bitmapContainer{cardinality: int(fb.counts[i]) + 1, bitmap: fb.bitsetAt(i)}
+	case frozenArrayType:
+		return &arrayContainer{fb.arrayAt(i)}
+	default:
+		return newRunContainer16TakeOwnership(fb.runsAt(i))
+	}
+}
+
+func (fb *FrozenBitmap) cardinalityAtIndex(i int) int {
+	if fb.typecodes[i] != frozenRunType {
+		return int(fb.counts[i]) + 1
+	}
+	card := 0
+	for _, iv := range fb.runsAt(i) {
+		card += int(iv.length) + 1
+	}
+	return card
+}
+
+// GetCardinality returns the number of integers contained in the bitmap
+func (fb *FrozenBitmap) GetCardinality() uint64 {
+	size := uint64(0)
+	for i := range fb.keys {
+		size += uint64(fb.cardinalityAtIndex(i))
+	}
+	return size
+}
+
+// IsEmpty returns true if the bitmap is empty
+func (fb *FrozenBitmap) IsEmpty() bool {
+	return len(fb.keys) == 0
+}
+
+// Contains returns true if the integer is contained in the bitmap
+func (fb *FrozenBitmap) Contains(x uint32) bool {
+	i := binarySearch(fb.keys, highbits(x))
+	if i < 0 {
+		return false
+	}
+	low := lowbits(x)
+	switch fb.typecodes[i] {
+	case frozenBitsetType:
+		bc := bitmapContainer{bitmap: fb.bitsetAt(i)}
+		return bc.contains(low)
+	case frozenArrayType:
+		ac := arrayContainer{fb.arrayAt(i)}
+		return ac.contains(low)
+	default:
+		rc := runContainer16{iv: fb.runsAt(i)}
+		return rc.contains(low)
+	}
+}
+
+// ToBitmap returns a regular bitmap holding a copy of the frozen one
+func (fb *FrozenBitmap) ToBitmap() *Bitmap {
+	answer := NewBitmap()
+	for i, key := range fb.keys {
+		answer.highlowcontainer.appendContainer(key, fb.containerAtIndex(i).clone(), false)
+	}
+	return answer
+}
+
+// And computes the intersection between the frozen bitmap and x2 and
+// returns the result as a new bitmap
+func (fb *FrozenBitmap) And(x2 *Bitmap) *Bitmap {
+	answer := NewBitmap()
+	ra := &x2.highlowcontainer
+	pos1, pos2 := 0, 0
+	length1, length2 := len(fb.keys), ra.size()
+	for pos1 < length1 && pos2 < length2 {
+		s1 := fb.keys[pos1]
+		s2 := ra.getKeyAtIndex(pos2)
+		if s1 == s2 {
+			c := fb.containerAtIndex(pos1).and(ra.getContainerAtIndex(pos2))
+			if c.getCardinality() > 0 {
+				answer.highlowcontainer.appendContainer(s1, c, false)
+			}
+			pos1++
+			pos2++
+		} else if s1 < s2 {
+			pos1 = advanceUntil(fb.keys, pos1, length1, s2)
+		} else {
+			pos2 = ra.advanceUntil(s1, pos2)
+		}
+	}
+	return answer
+}
+
+// AndCardinality returns the cardinality of the intersection between the
+// frozen bitmap and x2
+func (fb *FrozenBitmap) AndCardinality(x2 *Bitmap) uint64 {
+	answer := uint64(0)
+	ra := &x2.highlowcontainer
+	pos1, pos2 := 0, 0
+	length1, length2 := len(fb.keys), ra.size()
+	for pos1 < length1 && pos2 < length2 {
+		s1 := fb.keys[pos1]
+		s2 := ra.getKeyAtIndex(pos2)
+		if s1 == s2 {
+			answer += uint64(fb.containerAtIndex(pos1).andCardinality(ra.getContainerAtIndex(pos2)))
+			pos1++
+			pos2++
+		} else if s1 < s2 {
+			pos1 = advanceUntil(fb.keys, pos1, length1, s2)
+		} else {
+			pos2 = ra.advanceUntil(s1, pos2)
+		}
+	}
+	return answer
+}
+
+// Or computes the union between the frozen bitmap and x2 and returns the
+// result as a new bitmap
+func (fb *FrozenBitmap) Or(x2 *Bitmap) *Bitmap {
+	answer := NewBitmap()
+	ra := &x2.highlowcontainer
+	pos1, pos2 := 0, 0
+	length1, length2 := len(fb.keys), ra.size()
+	for pos1 < length1 && pos2 < length2 {
+		s1 := fb.keys[pos1]
+		s2 := ra.getKeyAtIndex(pos2)
+		if s1 < s2 {
+			answer.highlowcontainer.appendContainer(s1, fb.containerAtIndex(pos1).clone(), false)
+			pos1++
+		} else if s1 > s2 {
+			answer.highlowcontainer.appendCopy(*ra, pos2)
+			pos2++
+		} else {
+			answer.highlowcontainer.appendContainer(s1, fb.containerAtIndex(pos1).or(ra.getContainerAtIndex(pos2)), false)
+			pos1++
+			pos2++
+		}
+	}
+	for ; pos1 < length1; pos1++ {
+		answer.highlowcontainer.appendContainer(fb.keys[pos1], fb.containerAtIndex(pos1).clone(), false)
+	}
+	answer.highlowcontainer.appendCopyMany(*ra, pos2, length2)
+	return answer
+}
+
+// Iterator creates a new IntPeekable to iterate over the integers contained
+// in the frozen bitmap, in sorted order
+func (fb *FrozenBitmap) Iterator() IntPeekable {
+	fi := &frozenIterator{fb: fb}
+	fi.init()
+	return fi
+}
+
+// frozenIterator embeds the containers and their iterators so that moving
+// from one container to the next does not allocate
+type frozenIterator struct {
+	fb   *FrozenBitmap
+	pos  int
+	hs   uint32
+	iter shortPeekable
+
+	arrayIter  shortIterator
+	bitset     bitmapContainer
+	bitsetIter bitmapContainerShortIterator
+	run        runContainer16
+	runIter    runIterator16
+}
+
+func (fi *frozenIterator) init() {
+	fb := fi.fb
+	if fi.pos >= len(fb.keys) {
+		return
+	}
+	fi.hs = uint32(fb.keys[fi.pos]) << 16
+	switch fb.typecodes[fi.pos] {
+	case frozenBitsetType:
+		fi.bitset.bitmap = fb.bitsetAt(fi.pos)
+		fi.bitsetIter = bitmapContainerShortIterator{&fi.bitset, fi.bitset.NextSetBit(0)}
+		fi.iter = &fi.bitsetIter
+	case frozenArrayType:
+		fi.arrayIter = shortIterator{fb.arrayAt(fi.pos), 0}
+		fi.iter = &fi.arrayIter
+	default:
+		fi.run.iv = fb.runsAt(fi.pos)
+		fi.runIter = runIterator16{rc: &fi.run}
+		fi.iter = &fi.runIter
+	}
+}
+
+// HasNext returns true if there are more integers to iterate over
+func (fi *frozenIterator) HasNext() bool {
+	return fi.pos < len(fi.fb.keys)
+}
+
+// Next returns the next integer
+func (fi *frozenIterator) Next() uint32 {
+	x := uint32(fi.iter.next()) | fi.hs
+	if !fi.iter.hasNext() {
+		fi.pos++
+		fi.init()
+	}
+	return x
+}
+
+// PeekNext peeks the next value without advancing the iterator
+func (fi *frozenIterator) PeekNext() uint32 {
+	return uint32(fi.iter.peekNext()) | fi.hs
+}
+
+// AdvanceIfNeeded advances as long as the next value is smaller than minval
+func (fi *frozenIterator) AdvanceIfNeeded(minval uint32) {
+	to := highbits(minval)
+	if fi.HasNext() && uint16(fi.hs>>16) < to {
+		fi.pos = advanceUntil(fi.fb.keys, fi.pos, len(fi.fb.keys), to)
+		fi.init()
+	}
+	if fi.HasNext() && uint16(fi.hs>>16) == to {
+		fi.iter.advanceIfNeeded(lowbits(minval))
+		if !fi.iter.hasNext() {
+			fi.pos++
+			fi.init()
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package roaring
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// frozenTestBitmap holds array, bitset and run containers
+func frozenTestBitmap() *Bitmap {
+	r := rand.New(rand.NewSource(1))
+	rb := NewBitmap()
+	for i := 0; i < 1000; i++ {
+		rb.Add(uint32(r.Intn(1 << 16)))
+	}
+	for i := 0; i < 30000; i++ {
+		rb.Add(3<<16 | uint32(r.Intn(1<<16)))
+	}
+	rb.AddRange(5<<16+100, 7<<16+200)
+	rb.Add(MaxUint32)
+	rb.RunOptimize()
+	return rb
+}
+
+func TestFrozenLayout(t *testing.T) {
+	rb := BitmapOf(1, 3, 5)
+	rb.AddRange(1<<16, 1<<16+100)
+	rb.RunOptimize()
+
+	expected := []byte{
+		0x00, 0x00, 0x63, 0x00, // run (0, 99)
+		0x01, 0x00, 0x03, 0x00, 0x05, 0x00, // array
+		0x00, 0x00, 0x01, 0x00, // keys
+		0x02, 0x00, 0x01, 0x00, // counts
+		frozenArrayType, frozenRunType,
+		0xC6, 0x35, 0x01, 0x00, // 13766 | 2<<15
+	}
+	buf, err := rb.Freeze()
+	require.NoError(t, err)
+	assert.Equal(t, expected, buf)
+	assert.EqualValues(t, len(expected), rb.GetFrozenSizeInBytes())
+
+	_, err = rb.FreezeTo(make([]byte, len(expected)-1))
+	assert.Error(t, err)
+}
+
+// frozenFixtureBitmap is the bitmap of testdata/frozen_croaring.bin, see
+// testdata/frozen_croaring.c and testdata/frozen_croaring.py
+func frozenFixtureBitmap() *Bitmap {
+	rb := NewBitmap()
+	for i := uint32(0); i < 1000; i++ {
+		rb.Add(i * 7)
+	}
+	for i := uint32(0); i < 20000; i++ {
+		rb.Add(3<<16 + 2*i)
+	}
+	rb.AddRange(5<<16+100, 7<<16+200)
+	rb.Add(MaxUint32)
+	rb.RunOptimize()
+	return rb
+}
+
+func TestFrozenCRoaringFixture(t *testing.T) {
+	buf, err := ioutil.ReadFile("testdata/frozen_croaring.bin")
+	require.NoError(t, err)
+
+	rb := frozenFixtureBitmap()
+	fb, err := FrozenView(buf)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{frozenArrayType, frozenBitsetType, frozenRunType, frozenRunType, frozenRunType, frozenArrayType}, fb.typecodes)
+	assert.True(t, rb.Equals(fb.ToBitmap()))
+	assert.Equal(t, buf, mustFreeze(t, rb))
+}
+
+func TestFrozenView(t *testing.T) {
+	rb := frozenTestBitmap()
+	buf, err := rb.Freeze()
+	require.NoError(t, err)
+
+	fb, err := FrozenView(buf)
+	require.NoError(t, err)
+	assert.Equal(t, rb.GetCardinality(), fb.GetCardinality())
+	assert.True(t, rb.Equals(fb.ToBitmap()))
+
+	for i := 0; i < 100000; i++ {
+		x := uint32(rand.Intn(8 << 16))
+		assert.Equal(t, rb.Contains(x), fb.Contains(x))
+	}
+	assert.True(t, fb.Contains(MaxUint32))
+
+	expected := rb.ToArray()
+	var got []uint32
+	for it := fb.Iterator(); it.HasNext(); {
+		got = append(got, it.Next())
+	}
+	assert.Equal(t, expected, got)
+
+	it := fb.Iterator()
+	it.AdvanceIfNeeded(6 << 16)
+	assert.EqualValues(t, 6<<16, it.PeekNext())
+	it.AdvanceIfNeeded(7<<16 + 200)
+	assert.Equal(t, uint32(MaxUint32), it.Next())
+	assert.False(t, it.HasNext())
+
+	empty, err := FrozenView([]byte{0xC6, 0x35, 0x00, 0x00})
+	require.NoError(t, err)
+	assert.True(t, empty.IsEmpty())
+	assert.False(t, empty.Iterator().HasNext())
+}
+
+func TestFrozenSetOperations(t *testing.T) {
+	rb := frozenTestBitmap()
+	buf, err := rb.Freeze()
+	require.NoError(t, err)
+	fb, err := FrozenView(buf)
+	require.NoError(t, err)
+
+	other := NewBitmap()
+	for i := 0; i < 50000; i++ {
+		other.Add(uint32(rand.Intn(10 << 16)))
+	}
+	other.AddRange(6<<16, 6<<16+1000)
+
+	assert.True(t, And(rb, other).Equals(fb.And(other)))
+	assert.True(t, Or(rb, other).Equals(fb.Or(other)))
+	assert.Equal(t, rb.AndCardinality(other), fb.AndCardinality(other))
+
+	// results must not share storage with the frozen buffer
+	or := fb.Or(other)
+	or.RemoveRange(0, 1<<32)
+	assert.True(t, rb.Equals(fb.ToBitmap()))
+	assert.Equal(t, buf, mustFreeze(t, rb))
+}
+
+func mustFreeze(t *testing.T, rb *Bitmap) []byte {
+	buf, err := rb.Freeze()
+	require.NoError(t, err)
+	return buf
+}
+
+func TestFrozenNoAllocations(t *testing.T) {
+	buf := mustFreeze(t, frozenTestBitmap())
+	fb, err := FrozenView(buf)
+	require.NoError(t, err)
+
+	allocs := testing.AllocsPerRun(10, func() {
+		for x := uint32(0); x < 8<<16; x += 97 {
+			fb.Contains(x)
+		}
+	})
+	assert.EqualValues(t, 0, allocs)
+
+	allocs = testing.AllocsPerRun(10, func() {
+		for it := fb.Iterator(); it.HasNext(); {
+			it.Next()
+		}
+	})
+	assert.EqualValues(t, 1, allocs)
+}
+
+func TestFrozenMalformed(t *testing.T) {
+	buf := mustFreeze(t, frozenTestBitmap())
+
+	_, err := FrozenView(buf[:3])
+	assert.Error(t, err)
+
+	_, err = FrozenView(buf[1:])
+	assert.Error(t, err)
+
+	bad := append([]byte(nil), buf...)
+	bad[len(bad)-4]++
+	_, err = FrozenView(bad)
+	assert.Error(t, err)
+
+	// bad type code for the last container
+	bad = append([]byte(nil), buf...)
+	bad[len(bad)-5] = 7
+	_, err = FrozenView(bad)
+	assert.Error(t, err)
+
+	// too many containers for the buffer
+	_, err = FrozenView([]byte{0xC6, 0x35, 0x01, 0x00})
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package roaring
+
+// Interval is a range of consecutive integers, from Start to Last included
+type Interval struct {
+	Start uint32
+	Last  uint32
+}
+
+// IntervalIterable allows you to iterate over the maximal intervals of
+// consecutive integers contained in a Bitmap
+type IntervalIterable interface {
+	HasNext() bool
+	Next() Interval
+}
+
+type intervalIterator struct {
+	highlowcontainer *roaringArray
+	pos              int // index of the current container
+	loc              int // position within the current container
+	hasNext          bool
+	next             Interval
+}
+
+// nextInContainer returns the next maximal interval found within a
+// single container, and advances the iterator past it
+func (ii *intervalIterator) nextInContainer() (Interval, bool) {
+	ra := ii.highlowcontainer
+	for ii.pos < ra.size() {
+		hs := uint32(ra.getKeyAtIndex(ii.pos)) << 16
+		var start, last int
+		switch c := ra.getContainerAtIndex(ii.pos).(type) {
+		case *arrayContainer:
+			if ii.loc >= len(c.content) {
+				break
+			}
+			j := ii.loc
+			for j+1 < len(c.content) && c.content[j+1] == c.content[j]+1 {
+				j++
+			}
+			start, last = int(c.content[ii.loc]), int(c.content[j])
+			ii.loc = j + 1
+			return Interval{hs | uint32(start), hs | uint32(last)}, true
+		case *bitmapContainer:
+			start = c.NextSetBit(ii.loc)
+			if start < 0 {
+				break
+			}
+			end := c.nextClearBit(start)
+			ii.loc = end
+			return Interval{hs | uint32(start), hs | uint32(end-1)}, true
+		case *runContainer16:
+			if ii.loc >= len(c.iv) {
+				break
+			}
+			iv := c.iv[ii.loc]
+			ii.loc++
+			return Interval{hs | uint32(iv.start), hs | uint32(iv.last())}, true
+		}
+		ii.pos++
+		ii.loc = 0
+	}
+	return Interval{}, false
+}
+
+// HasNext returns true if there are more intervals to iterate over
+func (ii *intervalIterator) HasNext() bool {
+	return ii.hasNext
+}
+
+// Next returns the next maximal interval, intervals running across
+// container boundaries are merged
+func (ii *intervalIterator) Next() Interval {
+	answer := ii.next
+	for {
+		iv, ok := ii.nextInContainer()
+		if !ok {
+			ii.hasNext = false
+			break
+		}
+		if answer.Last != MaxUint32 && iv.Start == answer.Last+1 {
+			answer.Last = iv.Last
+			continue
+		}
+		ii.next = iv
+		break
+	}
+	return answer
+}
+
+func newIntervalIterator(a *Bitmap) *intervalIterator {
+	ii := &intervalIterator{highlowcontainer: &a.highlowcontainer}
+	ii.next, ii.hasNext = ii.nextInContainer()
+	return ii
+}
+
+// IntervalIterator creates a new IntervalIterable to iterate over the
+// maximal intervals of consecutive integers contained in the bitmap, in
+// sorted order; the iterator becomes invalid if the bitmap is modified
+// (e.g., with Add or Remove).
+func (rb *Bitmap) IntervalIterator() IntervalIterable {
+	return newIntervalIterator(rb)
+}
+
+// ToIntervals returns the maximal intervals of consecutive integers
+// contained in the bitmap, in sorted order
+func (rb *Bitmap) ToIntervals() []Interval {
+	var answer []Interval
+	for it := newIntervalIterator(rb); it.HasNext(); {
+		answer = append(answer, it.Next())
+	}
+	return answer
+}
+
+// AddIntervals adds all the integers of the given intervals to the
+// bitmap, intervals with Start > Last are ignored
+func (rb *Bitmap) AddIntervals(intervals []Interval) {
+	for _, iv := range intervals {
+		if iv.Start <= iv.Last {
+			rb.AddRange(uint64(iv.Start), uint64(iv.Last)+1)
+		}
+	}
+}
+
+// FromIntervals creates a new bitmap holding the integers of the given
+// intervals
+func FromIntervals(intervals ...Interval) *Bitmap {
+	rb := NewBitmap()
+	rb.AddIntervals(intervals)
+	return rb
+}
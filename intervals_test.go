@@ -0,0 +1,73 @@
+package roaring
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// naiveIntervals computes the maximal intervals from the sorted values
+func naiveIntervals(values []uint32) []Interval {
+	var answer []Interval
+	for i, v := range values {
+		if i > 0 && values[i-1]+1 == v {
+			answer[len(answer)-1].Last = v
+		} else {
+			answer = append(answer, Interval{v, v})
+		}
+	}
+	return answer
+}
+
+func TestIntervalIterator(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	rb := NewBitmap()
+	for i := 0; i < 3000; i++ {
+		start := uint64(r.Intn(1 << 22))
+		rb.AddRange(start, start+uint64(r.Intn(200)))
+	}
+	// runs crossing container boundaries
+	rb.AddRange(5<<16-10, 7<<16+10)
+	rb.AddRange(100<<16-1, 100<<16+1)
+	rb.AddRange(MaxUint32-5, MaxRange)
+	rb.Add(0)
+
+	runs := rb.Clone()
+	runs.RunOptimize()
+	bitmaps := NewBitmap()
+	bitmaps.Or(rb)
+	for i := uint32(0); i < 3000; i++ {
+		bitmaps.Add(200<<16 | i*2)
+	}
+
+	for _, b := range []*Bitmap{rb, runs, bitmaps} {
+		expected := naiveIntervals(b.ToArray())
+		assert.Equal(t, expected, b.ToIntervals())
+
+		var got []Interval
+		for it := b.IntervalIterator(); it.HasNext(); {
+			got = append(got, it.Next())
+		}
+		assert.Equal(t, expected, got)
+		assert.True(t, b.Equals(FromIntervals(got...)))
+	}
+
+	assert.Contains(t, rb.ToIntervals(), Interval{5<<16 - 10, 7<<16 + 9})
+	assert.Contains(t, rb.ToIntervals(), Interval{MaxUint32 - 5, MaxUint32})
+	assert.False(t, NewBitmap().IntervalIterator().HasNext())
+	assert.Nil(t, NewBitmap().ToIntervals())
+}
+
+func TestAddIntervals(t *testing.T) {
+	rb := BitmapOf(1, 2, 3)
+	rb.AddIntervals([]Interval{{10, 20}, {15, 30}, {MaxUint32, MaxUint32}, {50, 40}})
+	expected := BitmapOf(1, 2, 3, MaxUint32)
+	expected.AddRange(10, 31)
+	assert.True(t, expected.Equals(rb))
+	assert.Equal(t, []Interval{{1, 3}, {10, 30}, {MaxUint32, MaxUint32}}, rb.ToIntervals())
+
+	full := FromIntervals(Interval{0, MaxUint32})
+	assert.Equal(t, uint64(MaxRange), full.GetCardinality())
+	assert.Equal(t, []Interval{{0, MaxUint32}}, full.ToIntervals())
+}
@@ -0,0 +1,243 @@
+package roaring
+
+// LazyBitmap is a read-only view of a bitmap serialized in the portable
+// format that decodes its containers on first access. Creating it only
+// reads the headers, so that a few queries on a large serialized bitmap
+// cost much less than FromBuffer. As with FromBuffer, the buffer must not
+// be modified while the view, or a bitmap obtained with ToBitmap, is in
+// use. A LazyBitmap is not safe for concurrent use.
+type LazyBitmap struct {
+	header     serializedHeader
+	containers []container // decoded containers, nil until first accessed
+}
+
+// NewLazyBitmap returns a view of the bitmap serialized in buf. It checks
+// the headers and that every container lies within buf, but not the
+// containers themselves.
+func NewLazyBitmap(buf []byte) (*LazyBitmap, error) {
+	h, err := parseSerializedHeader(buf)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.checkBounds(); err != nil {
+		return nil, err
+	}
+	return &LazyBitmap{header: h, containers: make([]container, h.size)}, nil
+}
+
+func (lb *LazyBitmap) containerAtIndex(i int) container {
+	c := lb.containers[i]
+	if c == nil {
+		// bounds were checked by NewLazyBitmap
+		c, _ = lb.header.container(i)
+		lb.containers[i] = c
+	}
+	return c
+}
+
+// GetCardinality returns the number of integers contained in the bitmap,
+// without decoding any container
+func (lb *LazyBitmap) GetCardinality() uint64 {
+	size := uint64(0)
+	for i := 0; i < lb.header.size; i++ {
+		size += uint64(lb.header.cardinality(i))
+	}
+	return size
+}
+
+// IsEmpty returns true if the bitmap is empty
+func (lb *LazyBitmap) IsEmpty() bool {
+	return lb.header.size == 0
+}
+
+// Contains returns true if the integer is contained in the bitmap
+func (lb *LazyBitmap) Contains(x uint32) bool {
+	i := lb.header.getIndex(highbits(x))
+	return i >= 0 && lb.containerAtIndex(i).contains(lowbits(x))
+}
+
+// Rank returns the number of integers that are smaller or equal to x, it
+// decodes at most one container
+func (lb *LazyBitmap) Rank(x uint32) uint64 {
+	i := lb.header.getIndex(highbits(x))
+	n := i
+	if i < 0 {
+		n = -i - 1
+	}
+	size := uint64(0)
+	for j := 0; j < n; j++ {
+		size += uint64(lb.header.cardinality(j))
+	}
+	if i >= 0 {
+		size += uint64(lb.containerAtIndex(i).rank(lowbits(x)))
+	}
+	return size
+}
+
+// firstIndexOfRange returns the index of the first container whose key is
+// at least the key of first
+func (lb *LazyBitmap) firstIndexOfRange(first uint32) int {
+	i := lb.header.getIndex(highbits(first))
+	if i < 0 {
+		return -i - 1
+	}
+	return i
+}
+
+// RangeCardinality returns the number of integers in [start, end)
+func (lb *LazyBitmap) RangeCardinality(start, end uint64) uint64 {
+	first, last, ok := rangeBounds(start, end)
+	if !ok {
+		return 0
+	}
+	h := &lb.header
+	answer := uint64(0)
+	for i := lb.firstIndexOfRange(first); i < h.size && h.key(i) <= highbits(last); i++ {
+		s, e := containerRange(h.key(i), first, last)
+		if s == 0 && e == maxCapacity {
+			answer += uint64(h.cardinality(i))
+		} else {
+			answer += uint64(lb.containerAtIndex(i).getCardinalityInRange(s, e))
+		}
+	}
+	return answer
+}
+
+// ContainsRange returns true if all the integers in [start, end) are in
+// the bitmap, an empty range is always contained
+func (lb *LazyBitmap) ContainsRange(start, end uint64) bool {
+	if end > MaxRange {
+		return false
+	}
+	first, last, ok := rangeBounds(start, end)
+	if !ok {
+		return true
+	}
+	h := &lb.header
+	i := h.getIndex(highbits(first))
+	if i < 0 {
+		return false
+	}
+	// keys are strictly increasing, so the range must cover consecutive keys
+	j := i + int(highbits(last)-highbits(first))
+	if j >= h.size || h.key(j) != highbits(last) {
+		return false
+	}
+	for ; i <= j; i++ {
+		s, e := containerRange(h.key(i), first, last)
+		if s == 0 && e == maxCapacity {
+			if h.cardinality(i) != maxCapacity {
+				return false
+			}
+		} else if !lb.containerAtIndex(i).containsRange(s, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// IntersectsRange returns true if at least one integer in [start, end) is
+// in the bitmap
+func (lb *LazyBitmap) IntersectsRange(start, end uint64) bool {
+	first, last, ok := rangeBounds(start, end)
+	if !ok {
+		return false
+	}
+	h := &lb.header
+	for i := lb.firstIndexOfRange(first); i < h.size && h.key(i) <= highbits(last); i++ {
+		s, e := containerRange(h.key(i), first, last)
+		if s == 0 && e == maxCapacity {
+			return true
+		}
+		if lb.containerAtIndex(i).intersectsRange(s, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Iterator creates a new IntPeekable to iterate over the integers contained
+// in the bitmap, in sorted order, decoding the containers as it reaches
+// them
+func (lb *LazyBitmap) Iterator() IntPeekable {
+	it := &lazyIterator{lb: lb}
+	it.init()
+	return it
+}
+
+// ToBitmap decodes all the containers and returns them as a regular
+// bitmap which, as with FromBuffer, refers to the buffer and copies a
+// container before modifying it
+func (lb *LazyBitmap) ToBitmap() *Bitmap {
+	size := lb.header.size
+	rb := &Bitmap{roaringArray{
+		keys:            make([]uint16, size),
+		containers:      make([]container, size),
+		needCopyOnWrite: make([]bool, size),
+	}}
+	for i := 0; i < size; i++ {
+		rb.highlowcontainer.keys[i] = lb.header.key(i)
+		rb.highlowcontainer.containers[i] = lb.containerAtIndex(i)
+		rb.highlowcontainer.needCopyOnWrite[i] = true
+	}
+	return rb
+}
+
+type lazyIterator struct {
+	lb   *LazyBitmap
+	pos  int
+	hs   uint32
+	iter shortPeekable
+}
+
+func (li *lazyIterator) init() {
+	if li.pos < li.lb.header.size {
+		li.iter = li.lb.containerAtIndex(li.pos).getShortIterator()
+		li.hs = uint32(li.lb.header.key(li.pos)) << 16
+	}
+}
+
+// HasNext returns true if there are more integers to iterate over
+func (li *lazyIterator) HasNext() bool {
+	return li.pos < li.lb.header.size
+}
+
+// Next returns the next integer
+func (li *lazyIterator) Next() uint32 {
+	x := uint32(li.iter.next()) | li.hs
+	if !li.iter.hasNext() {
+		li.pos++
+		li.init()
+	}
+	return x
+}
+
+// PeekNext peeks the next value without advancing the iterator
+func (li *lazyIterator) PeekNext() uint32 {
+	return uint32(li.iter.peekNext()) | li.hs
+}
+
+// AdvanceIfNeeded advances as long as the next value is smaller than
+// minval, skipping the containers in between without decoding them
+func (li *lazyIterator) AdvanceIfNeeded(minval uint32) {
+	if !li.HasNext() || li.PeekNext() >= minval {
+		return
+	}
+	to := highbits(minval)
+	if li.lb.header.key(li.pos) < to {
+		i := li.lb.header.getIndex(to)
+		if i < 0 {
+			i = -i - 1
+		}
+		li.pos = i
+		li.init()
+		if !li.HasNext() || li.lb.header.key(li.pos) > to {
+			return
+		}
+	}
+	li.iter.advanceIfNeeded(lowbits(minval))
+	if !li.iter.hasNext() {
+		li.pos++
+		li.init()
+	}
+}
@@ -0,0 +1,109 @@
+package roaring
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lazyTestBitmaps() []*Bitmap {
+	withRuns := frozenTestBitmap()
+	withoutRuns := NewBitmap()
+	for i := 0; i < 50000; i++ {
+		withoutRuns.Add(uint32(rand.Intn(20 << 16)))
+	}
+	withoutRuns.AddRange(30<<16, 32<<16)
+	// fewer than noOffsetThreshold containers, with runs: no offset header
+	small := BitmapOf(1, 2, 3, 1<<16)
+	small.AddRange(2<<16+5, 2<<16+1000)
+	small.RunOptimize()
+	return []*Bitmap{withRuns, withoutRuns, small, NewBitmap(), BitmapOf(MaxUint32)}
+}
+
+func decodedContainers(lb *LazyBitmap) int {
+	n := 0
+	for _, c := range lb.containers {
+		if c != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLazyBitmap(t *testing.T) {
+	r := rand.New(rand.NewSource(18))
+	for _, rb := range lazyTestBitmaps() {
+		buf, err := rb.ToBytes()
+		require.NoError(t, err)
+		lb, err := NewLazyBitmap(buf)
+		require.NoError(t, err)
+		assert.Equal(t, 0, decodedContainers(lb))
+		assert.Equal(t, rb.GetCardinality(), lb.GetCardinality())
+		assert.Equal(t, rb.IsEmpty(), lb.IsEmpty())
+		assert.Equal(t, 0, decodedContainers(lb))
+
+		if !rb.IsEmpty() {
+			x := rb.Maximum()
+			assert.True(t, lb.Contains(x))
+			assert.Equal(t, 1, decodedContainers(lb))
+			assert.Equal(t, rb.Rank(x), lb.Rank(x))
+			assert.Equal(t, 1, decodedContainers(lb))
+		}
+
+		for i := 0; i < 2000; i++ {
+			x := uint32(r.Intn(40 << 16))
+			if i%100 == 0 {
+				x = MaxUint32 - uint32(i)
+			}
+			assert.Equal(t, rb.Contains(x), lb.Contains(x))
+			assert.Equal(t, rb.Rank(x), lb.Rank(x))
+			start := uint64(x)
+			end := start + uint64(r.Intn(3<<16))
+			assert.Equal(t, rb.RangeCardinality(start, end), lb.RangeCardinality(start, end))
+			assert.Equal(t, rb.ContainsRange(start, end), lb.ContainsRange(start, end))
+			assert.Equal(t, rb.IntersectsRange(start, end), lb.IntersectsRange(start, end))
+		}
+		assert.True(t, lb.ContainsRange(5, 5))
+		assert.Equal(t, rb.ContainsRange(5<<16+100, 7<<16+200), lb.ContainsRange(5<<16+100, 7<<16+200))
+		assert.Equal(t, rb.RangeCardinality(0, MaxRange), lb.RangeCardinality(0, MaxRange))
+
+		var got []uint32
+		for it := lb.Iterator(); it.HasNext(); {
+			got = append(got, it.Next())
+		}
+		assert.Equal(t, rb.ToArray(), append([]uint32{}, got...))
+
+		for i := 0; i < 200; i++ {
+			x := uint32(r.Intn(40 << 16))
+			it, expected := lb.Iterator(), rb.Iterator()
+			it.AdvanceIfNeeded(x)
+			expected.AdvanceIfNeeded(x)
+			assert.Equal(t, expected.HasNext(), it.HasNext())
+			if it.HasNext() {
+				assert.Equal(t, expected.PeekNext(), it.PeekNext())
+				assert.Equal(t, expected.Next(), it.Next())
+			}
+		}
+
+		c := lb.ToBitmap()
+		assert.True(t, rb.Equals(c))
+		c.Add(12345)
+		c.RemoveRange(0, 1<<16)
+		lb2, err := NewLazyBitmap(buf)
+		require.NoError(t, err)
+		assert.True(t, rb.Equals(lb2.ToBitmap()))
+	}
+}
+
+func TestLazyBitmapMalformed(t *testing.T) {
+	buf, err := frozenTestBitmap().ToBytes()
+	require.NoError(t, err)
+	for _, n := range []int{0, 3, 10, len(buf) / 2, len(buf) - 1} {
+		_, err := NewLazyBitmap(buf[:n])
+		assert.Error(t, err, "n=%d", n)
+	}
+	_, err = NewLazyBitmap([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package roaring
+
+import "fmt"
+
+// MapOptions configures OpenMappedWithOptions
+type MapOptions struct {
+	// Debug restricts the handle to its own accessors (Contains, Iterator,
+	// Or...), which panic once it is closed: Bitmap panics, so that no
+	// bitmap can read the mapping without the check, and the bitmaps
+	// returned by the accessors never share memory with the mapping.
+	Debug bool
+}
+
+// MappedBitmap is a read-only handle on a memory-mapped file holding a
+// serialized bitmap in the portable format. Where memory mapping is not
+// available, the file is read into memory instead. Its methods panic once
+// the handle is closed.
+type MappedBitmap struct {
+	bitmap  *Bitmap
+	data    []byte
+	options MapOptions
+	closed  bool
+}
+
+// OpenMapped maps the file at path and returns a handle on the bitmap it
+// holds, see OpenMappedWithOptions
+func OpenMapped(path string) (*MappedBitmap, error) {
+	return OpenMappedWithOptions(path, MapOptions{})
+}
+
+// OpenMappedWithOptions maps the file at path and returns a handle on the
+// bitmap it holds. The containers of the bitmap are not copied, as with
+// FromBuffer, and the file must not be modified until the handle is
+// closed.
+func OpenMappedWithOptions(path string, options MapOptions) (*MappedBitmap, error) {
+	data, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rb := NewBitmap()
+	if _, err := rb.FromBuffer(data); err != nil {
+		unmapFile(data)
+		return nil, fmt.Errorf("error reading mapped bitmap %s: %s", path, err)
+	}
+	return &MappedBitmap{bitmap: rb, data: data, options: options}, nil
+}
+
+func (mb *MappedBitmap) checkOpen() {
+	if mb.closed {
+		panic("roaring: use of a MappedBitmap after Close")
+	}
+}
+
+// Bitmap returns the mapped bitmap. It may be modified, the containers
+// are copied before being written, but neither it nor any bitmap derived
+// from it (e.g., via Or, And) may be used after Close, unless
+// CloneCopyOnWriteContainers was called on it: such a use is not
+// detected. Bitmap panics if the handle is closed or in debug mode.
+func (mb *MappedBitmap) Bitmap() *Bitmap {
+	mb.checkOpen()
+	if mb.options.Debug {
+		panic("roaring: Bitmap is not available on a MappedBitmap in debug mode")
+	}
+	return mb.bitmap
+}
+
+// Clone returns a copy of the bitmap that does not depend on the mapping
+func (mb *MappedBitmap) Clone() *Bitmap {
+	mb.checkOpen()
+	answer := mb.bitmap.Clone()
+	answer.CloneCopyOnWriteContainers()
+	return answer
+}
+
+// Contains returns true if the integer is contained in the bitmap
+func (mb *MappedBitmap) Contains(x uint32) bool {
+	mb.checkOpen()
+	return mb.bitmap.Contains(x)
+}
+
+// GetCardinality returns the number of integers contained in the bitmap
+func (mb *MappedBitmap) GetCardinality() uint64 {
+	mb.checkOpen()
+	return mb.bitmap.GetCardinality()
+}
+
+// Rank returns the number of integers that are smaller or equal to x
+func (mb *MappedBitmap) Rank(x uint32) uint64 {
+	mb.checkOpen()
+	return mb.bitmap.Rank(x)
+}
+
+// And computes the intersection of the bitmap and x, the result does not
+// depend on the mapping
+func (mb *MappedBitmap) And(x *Bitmap) *Bitmap {
+	mb.checkOpen()
+	answer := And(mb.bitmap, x)
+	answer.CloneCopyOnWriteContainers()
+	return answer
+}
+
+// Or computes the union of the bitmap and x, the result does not depend
+// on the mapping
+func (mb *MappedBitmap) Or(x *Bitmap) *Bitmap {
+	mb.checkOpen()
+	answer := Or(mb.bitmap, x)
+	answer.CloneCopyOnWriteContainers()
+	return answer
+}
+
+// Iterator creates a new IntPeekable to iterate over the integers of the
+// bitmap, it panics if used after Close
+func (mb *MappedBitmap) Iterator() IntPeekable {
+	mb.checkOpen()
+	return &mappedIterator{mb, mb.bitmap.Iterator()}
+}
+
+type mappedIterator struct {
+	mb *MappedBitmap
+	it IntPeekable
+}
+
+func (mi *mappedIterator) HasNext() bool {
+	mi.mb.checkOpen()
+	return mi.it.HasNext()
+}
+
+func (mi *mappedIterator) Next() uint32 {
+	mi.mb.checkOpen()
+	return mi.it.Next()
+}
+
+func (mi *mappedIterator) PeekNext() uint32 {
+	mi.mb.checkOpen()
+	return mi.it.PeekNext()
+}
+
+func (mi *mappedIterator) AdvanceIfNeeded(minval uint32) {
+	mi.mb.checkOpen()
+	mi.it.AdvanceIfNeeded(minval)
+}
+
+// Close unmaps the file
+func (mb *MappedBitmap) Close() error {
+	if mb.closed {
+		return fmt.Errorf("mapped bitmap already closed")
+	}
+	data := mb.data
+	mb.closed = true
+	mb.bitmap = nil
+	mb.data = nil
+	return unmapFile(data)
+}
@@ -0,0 +1,13 @@
+// +build !linux,!darwin appengine
+
+package roaring
+
+import "io/ioutil"
+
+func mapFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+func unmapFile(data []byte) error {
+	return nil
+}
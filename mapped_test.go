@@ -0,0 +1,89 @@
+package roaring
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTempBitmap(t *testing.T, rb *Bitmap) string {
+	f, err := ioutil.TempFile("", "roaring-mapped")
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = rb.WriteTo(f)
+	require.NoError(t, err)
+	return f.Name()
+}
+
+func TestMappedBitmap(t *testing.T) {
+	rb := frozenTestBitmap()
+	fname := writeTempBitmap(t, rb)
+	defer os.Remove(fname)
+
+	mb, err := OpenMapped(fname)
+	require.NoError(t, err)
+	assert.True(t, rb.Equals(mb.Bitmap()))
+
+	// modifications copy the containers
+	m := mb.Bitmap()
+	m.Add(7)
+	m.RemoveRange(3<<16, 4<<16)
+	assert.True(t, m.Contains(7))
+	mb2, err := OpenMapped(fname)
+	require.NoError(t, err)
+	assert.True(t, rb.Equals(mb2.Bitmap()))
+	assert.NoError(t, mb2.Close())
+
+	// a derived bitmap survives Close once its containers are cloned
+	derived := Or(mb.Bitmap(), BitmapOf(100<<16))
+	derived.CloneCopyOnWriteContainers()
+	expected := derived.Clone()
+	assert.NoError(t, mb.Close())
+	assert.Error(t, mb.Close())
+	assert.Panics(t, func() { mb.Bitmap() })
+	assert.Panics(t, func() { mb.Contains(7) })
+	assert.True(t, expected.Equals(derived))
+
+	_, err = OpenMapped(fname + ".missing")
+	assert.Error(t, err)
+	empty := writeTempBitmap(t, NewBitmap())
+	defer os.Remove(empty)
+	require.NoError(t, ioutil.WriteFile(empty, []byte{1, 2, 3}, 0600))
+	_, err = OpenMapped(empty)
+	assert.Error(t, err)
+}
+
+func TestMappedBitmapDebug(t *testing.T) {
+	rb := BitmapOf(1, 2, 3, 70000)
+	fname := writeTempBitmap(t, rb)
+	defer os.Remove(fname)
+
+	mb, err := OpenMappedWithOptions(fname, MapOptions{Debug: true})
+	require.NoError(t, err)
+	assert.Panics(t, func() { mb.Bitmap() })
+	assert.True(t, mb.Contains(2))
+	assert.False(t, mb.Contains(4))
+	assert.EqualValues(t, 4, mb.GetCardinality())
+	assert.EqualValues(t, 3, mb.Rank(3))
+	assert.True(t, rb.Equals(mb.Clone()))
+	assert.EqualValues(t, 2, mb.And(BitmapOf(2, 3, 4)).GetCardinality())
+
+	derived := mb.Or(BitmapOf(100 << 16))
+	it := mb.Iterator()
+	assert.EqualValues(t, 1, it.Next())
+	require.NoError(t, mb.Close())
+
+	// the results of the accessors do not depend on the mapping
+	assert.True(t, derived.Contains(2))
+	assert.True(t, derived.Contains(70000))
+
+	// any further use of the handle is detected
+	assert.PanicsWithValue(t, "roaring: use of a MappedBitmap after Close", func() { mb.Contains(2) })
+	assert.Panics(t, func() { mb.GetCardinality() })
+	assert.Panics(t, func() { mb.Or(rb) })
+	assert.Panics(t, func() { it.HasNext() })
+	assert.Panics(t, func() { it.Next() })
+}
@@ -93,13 +93,20 @@ func (h *bitmapContainerHeap) Next(containers []container) multipleContainers {
 }
 
 func newBitmapContainerHeap(bitmaps ...*Bitmap) bitmapContainerHeap {
+	return newBitmapContainerHeapFrom(0, bitmaps...)
+}
+
+// newBitmapContainerHeapFrom is like newBitmapContainerHeap but skips the
+// containers whose key is smaller than start
+func newBitmapContainerHeapFrom(start uint16, bitmaps ...*Bitmap) bitmapContainerHeap {
 	// Initialize heap
 	var h bitmapContainerHeap = make([]bitmapContainerKey, 0, len(bitmaps))
 	for _, bitmap := range bitmaps {
-		if !bitmap.IsEmpty() {
+		idx := bitmap.highlowcontainer.getIndexAtOrAfter(start)
+		if idx < bitmap.highlowcontainer.size() {
 			key := bitmapContainerKey{
-				bitmap.highlowcontainer.keys[0],
-				0,
+				bitmap.highlowcontainer.keys[idx],
+				idx,
 				bitmap,
 			}
 			h = append(h, key)
@@ -167,6 +174,7 @@ func appenderRoutine(bitmapChan chan<- *Bitmap, resultChan <-chan keyedContainer
 			make([]bool, 0, expectedKeys),
 			false,
 			nil,
+			nil,
 		},
 	}
 	for i := range keys {
@@ -259,6 +267,36 @@ func ParHeapOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
 	return bitmap
 }
 
+// ParAddManyUnsorted is like AddManyUnsorted but splits dat into parts
+// that are sorted and turned into containers in parallel, where the
+// parameter "parallelism" determines how many workers are to be used
+// (if it is set to 0, a default number of workers is chosen)
+func (rb *Bitmap) ParAddManyUnsorted(parallelism int, dat []uint32) {
+	if parallelism == 0 {
+		parallelism = defaultWorkerCount
+	}
+	if parallelism == 1 || len(dat) < 2*parallelism {
+		rb.AddManyUnsorted(dat)
+		return
+	}
+
+	chunkSize := (len(dat) + parallelism - 1) / parallelism
+	parts := make([]*Bitmap, 0, parallelism)
+	var wg sync.WaitGroup
+	for start := 0; start < len(dat); start += chunkSize {
+		part := NewBitmap()
+		parts = append(parts, part)
+		chunk := dat[start:minOfInt(start+chunkSize, len(dat))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			part.AddManyUnsorted(chunk)
+		}()
+	}
+	wg.Wait()
+	rb.Or(ParOr(parallelism, parts...))
+}
+
 // ParAnd computes the intersection (AND) of all provided bitmaps in parallel,
 // where the parameter "parallelism" determines how many workers are to be used
 // (if it is set to 0, a default number of workers is chosen)
@@ -365,10 +403,29 @@ func ParOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
 		return FastOr(bitmaps...)
 	}
 
+	return parAggregateOnRange(parallelism, lKey, hKey, func(start, last uint16) *roaringArray {
+		ra := lazyOrOnRange(&bitmaps[0].highlowcontainer, &bitmaps[1].highlowcontainer, start, last)
+		for _, b := range bitmaps[2:] {
+			ra = lazyIOrOnRange(ra, &b.highlowcontainer, start, last)
+		}
+
+		for i, c := range ra.containers {
+			ra.containers[i] = repairAfterLazy(c)
+		}
+		return ra
+	})
+}
+
+// parAggregateOnRange splits the keys from lKey to hKey (included) into
+// chunks, has the workers compute the aggregate of each chunk and
+// concatenates the results
+func parAggregateOnRange(parallelism int, lKey, hKey uint16, aggregate func(start, last uint16) *roaringArray) *Bitmap {
 	if parallelism == 0 {
 		parallelism = defaultWorkerCount
 	}
 
+	keyRange := int(hKey) - int(lKey) + 1
+
 	var chunkSize int
 	var chunkCount int
 	if parallelism*4 > int(keyRange) {
@@ -389,23 +446,14 @@ func ParOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
 	chunkSpecChan := make(chan parChunkSpec, minOfInt(maxOfInt(64, 2*parallelism), int(chunkCount)))
 	chunkChan := make(chan parChunk, minOfInt(32, int(chunkCount)))
 
-	orFunc := func() {
+	aggregateFunc := func() {
 		for spec := range chunkSpecChan {
-			ra := lazyOrOnRange(&bitmaps[0].highlowcontainer, &bitmaps[1].highlowcontainer, spec.start, spec.end)
-			for _, b := range bitmaps[2:] {
-				ra = lazyIOrOnRange(ra, &b.highlowcontainer, spec.start, spec.end)
-			}
-
-			for i, c := range ra.containers {
-				ra.containers[i] = repairAfterLazy(c)
-			}
-
-			chunkChan <- parChunk{ra, spec.idx}
+			chunkChan <- parChunk{aggregate(spec.start, spec.end), spec.idx}
 		}
 	}
 
 	for i := 0; i < parallelism; i++ {
-		go orFunc()
+		go aggregateFunc()
 	}
 
 	go func() {
@@ -611,3 +659,317 @@ func lazyIOrOnRange(ra1, ra2 *roaringArray, start, last uint16) *roaringArray {
 	}
 	return ra1
 }
+
+// repairAfterLazyXor is like repairAfterLazy but returns nil for
+// containers left empty
+func repairAfterLazyXor(c container) container {
+	if bc, ok := c.(*bitmapContainer); ok && bc.cardinality == invalidCardinality {
+		bc.computeCardinality()
+		if bc.cardinality == 0 {
+			return nil
+		}
+	}
+	return repairAfterLazy(c)
+}
+
+// toWritableBitmapContainer returns a copy of c as a bitmap container
+func toWritableBitmapContainer(c container) *bitmapContainer {
+	switch t := c.(type) {
+	case *arrayContainer:
+		return t.toBitmapContainer()
+	case *runContainer16:
+		return t.toBitmapContainer()
+	}
+	return c.clone().(*bitmapContainer)
+}
+
+// xorOnRange computes the symmetric difference of the bitmaps over the
+// keys from start to last (included)
+func xorOnRange(bitmaps []*Bitmap, start, last uint16) *roaringArray {
+	answer := newRoaringArray()
+	h := newBitmapContainerHeapFrom(start, bitmaps...)
+	var containers []container
+	for h.Len() > 0 && h.Peek().key <= last {
+		mc := h.Next(containers[:0])
+		containers = mc.containers
+		if len(containers) == 1 {
+			answer.appendContainer(mc.key, containers[0].clone(), false)
+			continue
+		}
+		bc := toWritableBitmapContainer(containers[0])
+		for _, c := range containers[1:] {
+			bc.lazyIXOR(c)
+		}
+		if c := repairAfterLazyXor(bc); c != nil {
+			answer.appendContainer(mc.key, c, false)
+		}
+	}
+	return answer
+}
+
+// andNotOnRange computes the difference between base and the union of
+// others over the keys from start to last (included)
+func andNotOnRange(base *Bitmap, others []*Bitmap, start, last uint16) *roaringArray {
+	answer := newRoaringArray()
+	ra := &base.highlowcontainer
+	positions := make([]int, len(others))
+	for i, o := range others {
+		positions[i] = o.highlowcontainer.getIndexAtOrAfter(start)
+	}
+	var containers []container
+	for idx := ra.getIndexAtOrAfter(start); idx < ra.size() && ra.getKeyAtIndex(idx) <= last; idx++ {
+		key := ra.getKeyAtIndex(idx)
+		containers = containers[:0]
+		for i, o := range others {
+			ora := &o.highlowcontainer
+			pos := positions[i]
+			if pos < ora.size() && ora.getKeyAtIndex(pos) < key {
+				pos = ora.advanceUntil(key, pos)
+				positions[i] = pos
+			}
+			if pos < ora.size() && ora.getKeyAtIndex(pos) == key {
+				containers = append(containers, ora.getContainerAtIndex(pos))
+			}
+		}
+
+		c := ra.getContainerAtIndex(idx)
+		if len(containers) == 0 {
+			answer.appendContainer(key, c.clone(), false)
+			continue
+		}
+		if ac, ok := c.(*arrayContainer); ok {
+			// small containers are cheaper to subtract from directly
+			var answerc container = ac
+			for _, o := range containers {
+				answerc = answerc.andNot(o)
+				if answerc.getCardinality() == 0 {
+					break
+				}
+			}
+			if answerc.getCardinality() > 0 {
+				answer.appendContainer(key, answerc, false)
+			}
+			continue
+		}
+		bc := toWritableBitmapContainer(c)
+		for _, o := range containers {
+			bc.lazyIANDNOT(o)
+		}
+		if c := repairAfterLazyXor(bc); c != nil {
+			answer.appendContainer(key, c, false)
+		}
+	}
+	return answer
+}
+
+// ParXor computes the symmetric difference (XOR) of all provided bitmaps in
+// parallel, where the parameter "parallelism" determines how many workers
+// are to be used (if it is set to 0, a default number of workers is chosen)
+func ParXor(parallelism int, bitmaps ...*Bitmap) *Bitmap {
+	var lKey uint16 = MaxUint16
+	var hKey uint16
+	nonEmpty := 0
+	for _, b := range bitmaps {
+		if !b.IsEmpty() {
+			lKey = minOfUint16(lKey, b.highlowcontainer.keys[0])
+			hKey = maxOfUint16(hKey, b.highlowcontainer.keys[b.highlowcontainer.size()-1])
+			nonEmpty++
+		}
+	}
+	if nonEmpty <= 1 || lKey == hKey {
+		return FastXor(bitmaps...)
+	}
+	return parAggregateOnRange(parallelism, lKey, hKey, func(start, last uint16) *roaringArray {
+		return xorOnRange(bitmaps, start, last)
+	})
+}
+
+// ParAndNot computes the difference between base and the union of all the
+// other provided bitmaps in parallel, where the parameter "parallelism"
+// determines how many workers are to be used (if it is set to 0, a default
+// number of workers is chosen)
+func ParAndNot(parallelism int, base *Bitmap, others ...*Bitmap) *Bitmap {
+	if base.IsEmpty() {
+		return NewBitmap()
+	}
+	lKey := base.highlowcontainer.keys[0]
+	hKey := base.highlowcontainer.keys[base.highlowcontainer.size()-1]
+	if lKey == hKey {
+		return FastAndNot(base, others...)
+	}
+	return parAggregateOnRange(parallelism, lKey, hKey, func(start, last uint16) *roaringArray {
+		return andNotOnRange(base, others, start, last)
+	})
+}
+
+// thresholdCounters counts, for every value of a container, how many of
+// the containers sharing a key hold it. The counts are bit-sliced: bit j
+// of the count of value v is bit v of counters[j].
+type thresholdCounters struct {
+	counters [][]uint64
+	scratch  []uint64
+}
+
+func newThresholdCounters(n int) *thresholdCounters {
+	width := 0
+	for ; n > 0; n >>= 1 {
+		width++
+	}
+	tc := &thresholdCounters{
+		counters: make([][]uint64, width),
+		scratch:  make([]uint64, maxCapacity/64),
+	}
+	for j := range tc.counters {
+		tc.counters[j] = make([]uint64, maxCapacity/64)
+	}
+	return tc
+}
+
+func (tc *thresholdCounters) reset() {
+	for _, c := range tc.counters {
+		for i := range c {
+			c[i] = 0
+		}
+	}
+}
+
+// words returns the values of c as a bitmap, using scratch unless c is
+// already a bitmap container
+func (tc *thresholdCounters) words(c container) []uint64 {
+	switch t := c.(type) {
+	case *bitmapContainer:
+		return t.bitmap
+	case *arrayContainer:
+		for i := range tc.scratch {
+			tc.scratch[i] = 0
+		}
+		for _, v := range t.content {
+			tc.scratch[v>>6] |= uint64(1) << (v & 63)
+		}
+	case *runContainer16:
+		for i := range tc.scratch {
+			tc.scratch[i] = 0
+		}
+		for _, iv := range t.iv {
+			setBitmapRange(tc.scratch, int(iv.start), int(iv.last())+1)
+		}
+	}
+	return tc.scratch
+}
+
+// add increments the counts of the values of c, with a ripple-carry
+// addition on each word
+func (tc *thresholdCounters) add(c container) {
+	for i, w := range tc.words(c) {
+		carry := w
+		for j := 0; carry != 0; j++ {
+			next := tc.counters[j][i] & carry
+			tc.counters[j][i] ^= carry
+			carry = next
+		}
+	}
+}
+
+// atLeast returns the values counted at least k times, comparing the counts
+// with k from their most significant bit
+func (tc *thresholdCounters) atLeast(k int) *bitmapContainer {
+	answer := newBitmapContainer()
+	for i := range answer.bitmap {
+		gt, eq := uint64(0), ^uint64(0)
+		for j := len(tc.counters) - 1; j >= 0; j-- {
+			c := tc.counters[j][i]
+			if k&(1<<uint(j)) != 0 {
+				eq &= c
+			} else {
+				gt |= eq & c
+				eq &^= c
+			}
+		}
+		answer.bitmap[i] = gt | eq
+	}
+	answer.cardinality = invalidCardinality
+	return answer
+}
+
+// thresholdOnRange computes the values present in at least k of the
+// bitmaps over the keys from start to last (included); k must be at least
+// 1 and at most len(bitmaps)
+func thresholdOnRange(k int, bitmaps []*Bitmap, start, last uint16) *roaringArray {
+	answer := newRoaringArray()
+	h := newBitmapContainerHeapFrom(start, bitmaps...)
+	var tc *thresholdCounters
+	var containers []container
+	for h.Len() > 0 && h.Peek().key <= last {
+		mc := h.Next(containers[:0])
+		containers = mc.containers
+		if len(containers) < k {
+			continue
+		}
+		var c container
+		if len(containers) == 1 {
+			c = containers[0].clone()
+		} else if len(containers) == k {
+			// every container must hold the value
+			c = containers[0].and(containers[1])
+			for _, next := range containers[2:] {
+				if c.getCardinality() == 0 {
+					break
+				}
+				c = c.iand(next)
+			}
+			if c.getCardinality() == 0 {
+				c = nil
+			}
+		} else if k == 1 {
+			c = toBitmapContainer(containers[0]).lazyOR(containers[1])
+			for _, next := range containers[2:] {
+				c = c.lazyIOR(next)
+			}
+			c = repairAfterLazy(c)
+		} else {
+			if tc == nil {
+				tc = newThresholdCounters(len(bitmaps))
+			}
+			tc.reset()
+			for _, next := range containers {
+				tc.add(next)
+			}
+			c = repairAfterLazyXor(tc.atLeast(k))
+		}
+		if c != nil {
+			answer.appendContainer(mc.key, c, false)
+		}
+	}
+	return answer
+}
+
+// ParThreshold computes the values present in at least k of the provided
+// bitmaps in parallel, where the parameter "parallelism" determines how
+// many workers are to be used (if it is set to 0, a default number of
+// workers is chosen). A k smaller than 1 is treated as 1.
+func ParThreshold(parallelism int, k int, bitmaps ...*Bitmap) *Bitmap {
+	if k < 1 {
+		k = 1
+	}
+	if k > len(bitmaps) {
+		return NewBitmap()
+	}
+
+	var lKey uint16 = MaxUint16
+	var hKey uint16
+	empty := true
+	for _, b := range bitmaps {
+		if !b.IsEmpty() {
+			lKey = minOfUint16(lKey, b.highlowcontainer.keys[0])
+			hKey = maxOfUint16(hKey, b.highlowcontainer.keys[b.highlowcontainer.size()-1])
+			empty = false
+		}
+	}
+	if empty {
+		return NewBitmap()
+	}
+
+	return parAggregateOnRange(parallelism, lKey, hKey, func(start, last uint16) *roaringArray {
+		return thresholdOnRange(k, bitmaps, start, last)
+	})
+}
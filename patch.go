@@ -0,0 +1,233 @@
+package roaring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Patch holds the changes turning a bitmap into another one, see Diff and
+// Apply. Its serialized form, written by WriteTo, is proportional to the
+// containers that changed rather than to the size of the bitmaps.
+type Patch struct {
+	ops []patchOp
+}
+
+const (
+	patchRemove  = iota // the container is removed
+	patchReplace        // the container is replaced by c
+	patchXor            // the container is XORed with c
+	// set on the kind when c is a run container in the serialized form
+	patchRunFlag = 0x80
+)
+
+type patchOp struct {
+	key  uint16
+	kind uint8
+	c    container
+}
+
+// The serialized form of a patch is made of patchMagic, the version and the
+// number of changes as a little endian uint32, followed by each change: the
+// key as a little endian uint16, the kind, and for a replacement or XOR the
+// cardinality minus one as a little endian uint16 and the container as in
+// the portable format.
+const (
+	patchMagic   = "RBDF"
+	patchVersion = 1
+)
+
+// Diff returns the patch turning old into new: the containers of old
+// missing from new are removed, the containers of new missing from old are
+// added and the containers that differ are either replaced or XORed,
+// whichever is smaller. Neither bitmap is modified.
+func Diff(old, new *Bitmap) Patch {
+	var p Patch
+	ra1, ra2 := &old.highlowcontainer, &new.highlowcontainer
+	pos1, pos2 := 0, 0
+	for pos1 < ra1.size() || pos2 < ra2.size() {
+		if pos2 == ra2.size() || (pos1 < ra1.size() && ra1.getKeyAtIndex(pos1) < ra2.getKeyAtIndex(pos2)) {
+			p.ops = append(p.ops, patchOp{key: ra1.getKeyAtIndex(pos1), kind: patchRemove})
+			pos1++
+		} else if pos1 == ra1.size() || ra1.getKeyAtIndex(pos1) > ra2.getKeyAtIndex(pos2) {
+			c := ra2.getContainerAtIndex(pos2).clone()
+			p.ops = append(p.ops, patchOp{key: ra2.getKeyAtIndex(pos2), kind: patchReplace, c: c})
+			pos2++
+		} else {
+			c1, c2 := ra1.getContainerAtIndex(pos1), ra2.getContainerAtIndex(pos2)
+			if !c1.equals(c2) {
+				op := patchOp{key: ra1.getKeyAtIndex(pos1), kind: patchReplace, c: c2.clone()}
+				if x := c1.xor(c2).toEfficientContainer(); x.serializedSizeInBytes() < c2.serializedSizeInBytes() {
+					op.kind, op.c = patchXor, x
+				}
+				p.ops = append(p.ops, op)
+			}
+			pos1++
+			pos2++
+		}
+	}
+	return p
+}
+
+// Apply returns a new bitmap holding old with the changes of patch, which
+// should have been computed by Diff from a bitmap equal to old. Neither old
+// nor patch is modified.
+func Apply(old *Bitmap, patch Patch) *Bitmap {
+	answer := NewBitmap()
+	ra := &old.highlowcontainer
+	pos := 0
+	for _, op := range patch.ops {
+		for pos < ra.size() && ra.getKeyAtIndex(pos) < op.key {
+			answer.highlowcontainer.appendCopy(*ra, pos)
+			pos++
+		}
+		var c container
+		if pos < ra.size() && ra.getKeyAtIndex(pos) == op.key {
+			c = ra.getContainerAtIndex(pos)
+			pos++
+		}
+		switch op.kind {
+		case patchReplace:
+			c = op.c.clone()
+		case patchXor:
+			if c == nil {
+				c = op.c.clone()
+			} else {
+				c = c.xor(op.c)
+			}
+		default:
+			c = nil
+		}
+		if c != nil && c.getCardinality() > 0 {
+			answer.highlowcontainer.appendContainer(op.key, c, false)
+		}
+	}
+	for ; pos < ra.size(); pos++ {
+		answer.highlowcontainer.appendCopy(*ra, pos)
+	}
+	return answer
+}
+
+// IsEmpty returns true if the patch holds no change
+func (p Patch) IsEmpty() bool {
+	return len(p.ops) == 0
+}
+
+// WriteTo writes the serialized form of the patch to stream
+func (p Patch) WriteTo(stream io.Writer) (int64, error) {
+	header := make([]byte, len(patchMagic)+1+4)
+	copy(header, patchMagic)
+	header[len(patchMagic)] = patchVersion
+	binary.LittleEndian.PutUint32(header[len(patchMagic)+1:], uint32(len(p.ops)))
+	written, err := stream.Write(header)
+	n := int64(written)
+	if err != nil {
+		return n, err
+	}
+	buf := make([]byte, 5)
+	for _, op := range p.ops {
+		binary.LittleEndian.PutUint16(buf, op.key)
+		buf[2] = op.kind
+		size := 3
+		if op.kind != patchRemove {
+			if _, ok := op.c.(*runContainer16); ok {
+				buf[2] |= patchRunFlag
+			}
+			binary.LittleEndian.PutUint16(buf[3:], uint16(op.c.getCardinality()-1))
+			size = 5
+		}
+		written, err := stream.Write(buf[:size])
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+		if op.kind != patchRemove {
+			written, err := op.c.writeTo(stream)
+			n += int64(written)
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom reads a patch written by WriteTo, replacing the content of p.
+// On error, p is left empty.
+func (p *Patch) ReadFrom(reader io.Reader) (int64, error) {
+	stream := byteInputAdapterPool.Get().(*byteInputAdapter)
+	stream.reset(reader)
+	defer byteInputAdapterPool.Put(stream)
+
+	p.ops = nil
+	header, err := stream.next(len(patchMagic) + 1)
+	if err != nil {
+		return stream.getReadBytes(), fmt.Errorf("malformed patch, could not read header: %s", err)
+	}
+	if string(header[:len(patchMagic)]) != patchMagic {
+		return stream.getReadBytes(), fmt.Errorf("malformed patch, did not find expected magic in header")
+	}
+	if v := header[len(patchMagic)]; v != patchVersion {
+		return stream.getReadBytes(), fmt.Errorf("unsupported patch version %d", v)
+	}
+	count, err := stream.readUInt32()
+	if err != nil {
+		return stream.getReadBytes(), fmt.Errorf("malformed patch, could not read header: %s", err)
+	}
+	if count > maxCapacity {
+		return stream.getReadBytes(), fmt.Errorf("malformed patch, %d changes for at most (1<<16) containers", count)
+	}
+
+	var ops []patchOp
+	last := -1
+	for i := uint32(0); i < count; i++ {
+		key, err := stream.readUInt16()
+		if err != nil {
+			return stream.getReadBytes(), fmt.Errorf("malformed patch, could not read change %d: %s", i, err)
+		}
+		if int(key) <= last {
+			return stream.getReadBytes(), fmt.Errorf("malformed patch, keys not strictly increasing at change %d: %d after %d", i, key, last)
+		}
+		last = int(key)
+		kind, err := stream.next(1)
+		if err != nil {
+			return stream.getReadBytes(), fmt.Errorf("malformed patch, could not read change %d: %s", i, err)
+		}
+		op := patchOp{key: key, kind: kind[0] &^ patchRunFlag}
+		if op.kind > patchXor {
+			return stream.getReadBytes(), fmt.Errorf("malformed patch, unknown kind of change %d", kind[0])
+		}
+		if op.kind != patchRemove {
+			card, err := stream.readUInt16()
+			if err != nil {
+				return stream.getReadBytes(), fmt.Errorf("malformed patch, could not read change %d: %s", i, err)
+			}
+			op.c, err = readContainer(stream, int(card)+1, kind[0]&patchRunFlag != 0)
+			if err != nil {
+				return stream.getReadBytes(), fmt.Errorf("malformed patch, change %d: %s", i, err)
+			}
+			if err := op.c.validate(); err != nil {
+				return stream.getReadBytes(), fmt.Errorf("malformed patch, invalid container in change %d: %s", i, err)
+			}
+		}
+		ops = append(ops, op)
+	}
+	p.ops = ops
+	return stream.getReadBytes(), nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface for the
+// patch
+func (p Patch) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := p.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for
+// the patch
+func (p *Patch) UnmarshalBinary(data []byte) error {
+	_, err := p.ReadFrom(bytes.NewReader(data))
+	return err
+}
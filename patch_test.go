@@ -0,0 +1,114 @@
+package roaring
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatch(t *testing.T) {
+	r := rand.New(rand.NewSource(24))
+	for iter := 0; iter < 20; iter++ {
+		old := NewBitmap()
+		for i := 0; i < 20000; i++ {
+			old.Add(uint32(r.Intn(30 << 16)))
+		}
+		old.AddRange(40<<16, 42<<16+r.Uint64()%(1<<16))
+		if iter%2 == 0 {
+			old.RunOptimize()
+		}
+		new := old.Clone()
+		for i := 0; i < 100; i++ {
+			x := uint32(r.Intn(50 << 16))
+			if r.Intn(2) == 0 {
+				new.Add(x)
+			} else {
+				new.Remove(x)
+			}
+		}
+		new.RemoveRange(uint64(r.Intn(10))<<16, uint64(r.Intn(10)+10)<<16)
+		new.AddRange(60<<16, 60<<16+100)
+		new.RunOptimize()
+		oldCopy := old.Clone()
+		newCopy := new.Clone()
+
+		p := Diff(old, new)
+		assert.True(t, new.Equals(Apply(old, p)))
+		assert.True(t, oldCopy.Equals(old))
+		assert.True(t, newCopy.Equals(new))
+
+		var buf bytes.Buffer
+		n, err := p.WriteTo(&buf)
+		require.NoError(t, err)
+		assert.EqualValues(t, buf.Len(), n)
+		var q Patch
+		m, err := q.ReadFrom(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, n, m)
+		answer := Apply(old, q)
+		assert.True(t, new.Equals(answer))
+
+		// the patch is reusable and independent of the bitmaps
+		answer.Add(MaxUint32)
+		new.Add(MaxUint32 - 1)
+		assert.True(t, newCopy.Equals(Apply(old, p)))
+		assert.True(t, newCopy.Equals(Apply(old, q)))
+	}
+}
+
+func TestPatchSize(t *testing.T) {
+	old := NewBitmap()
+	for i := uint32(0); i < 1<<22; i += 3 {
+		old.Add(i)
+	}
+	new := old.Clone()
+	new.Add(1)
+	new.Remove(3 << 16)
+
+	p := Diff(old, new)
+	require.Len(t, p.ops, 2)
+	for _, op := range p.ops {
+		assert.Equal(t, uint8(patchXor), op.kind)
+	}
+	data, err := p.MarshalBinary()
+	require.NoError(t, err)
+	assert.True(t, len(data) < 64)
+	assert.True(t, Diff(old, old.Clone()).IsEmpty())
+
+	var q Patch
+	require.NoError(t, q.UnmarshalBinary(data))
+	assert.True(t, new.Equals(Apply(old, q)))
+
+	// to and from an empty bitmap
+	assert.True(t, old.Equals(Apply(NewBitmap(), Diff(NewBitmap(), old))))
+	assert.True(t, Apply(old, Diff(old, NewBitmap())).IsEmpty())
+}
+
+func TestPatchMalformed(t *testing.T) {
+	old := BitmapOf(1, 2, 3, 1<<16, 2<<16)
+	new := BitmapOf(1, 5, 2<<16, 3<<16)
+	p := Diff(old, new)
+	data, err := p.MarshalBinary()
+	require.NoError(t, err)
+
+	corrupt := func(i int, b byte) []byte {
+		c := append([]byte(nil), data...)
+		c[i] = b
+		return c
+	}
+	for _, bad := range [][]byte{
+		data[:3],
+		data[:len(data)-1],
+		corrupt(0, 'X'),
+		corrupt(4, patchVersion+1),
+		corrupt(11, 7), // unknown kind
+		corrupt(9, 9),  // keys out of order
+	} {
+		q := p
+		assert.Error(t, q.UnmarshalBinary(bad))
+		assert.True(t, q.IsEmpty())
+	}
+}
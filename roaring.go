@@ -10,6 +10,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"sync"
 )
@@ -58,7 +59,7 @@ func (rb *Bitmap) ToBytes() ([]byte, error) {
 // experimental: it may produce smaller on disk
 // footprint and/or be faster to read, depending
 // on your content. Currently only the Go roaring
-// implementation supports this format.
+// implementation supports this format. Use WriteToCompressed instead.
 func (rb *Bitmap) WriteToMsgpack(stream io.Writer) (int64, error) {
 	return 0, rb.highlowcontainer.writeToMsgpack(stream)
 }
@@ -109,6 +110,79 @@ func (rb *Bitmap) FromBuffer(buf []byte) (p int64, err error) {
 	return
 }
 
+// ReadFromValidated is like ReadFrom but also checks that the serialized
+// bitmap is well formed: keys must be strictly increasing, array values
+// sorted without duplicates, runs neither overlapping nor overflowing, and
+// the cardinalities found in the header must match the payload.
+// It should be preferred to ReadFrom on untrusted input.
+// On error, the bitmap is left empty.
+func (rb *Bitmap) ReadFromValidated(reader io.Reader) (p int64, err error) {
+	p, err = rb.ReadFrom(reader)
+	if err == nil {
+		err = rb.highlowcontainer.validate()
+	}
+	if err != nil {
+		rb.Clear()
+	}
+	return
+}
+
+// FromBufferValidated is like FromBuffer but also checks that the
+// serialized bitmap is well formed (see ReadFromValidated).
+// It should be preferred to FromBuffer on untrusted input.
+// On error, the bitmap is left empty.
+func (rb *Bitmap) FromBufferValidated(buf []byte) (p int64, err error) {
+	p, err = rb.FromBuffer(buf)
+	if err == nil {
+		err = rb.highlowcontainer.validate()
+	}
+	if err != nil {
+		rb.Clear()
+	}
+	return
+}
+
+// ReadRange is like ReadFrom but only keeps the integers in [minValue,
+// maxValue]. The containers below the range are skipped: when the
+// serialized bitmap has an offset header and reader implements io.Seeker,
+// it seeks straight to the first container in range. The containers at the
+// boundaries are trimmed and reading stops after the last container in
+// range, so the stream is not necessarily consumed to the end.
+// On error, the bitmap is left empty.
+func (rb *Bitmap) ReadRange(reader io.Reader, minValue, maxValue uint32) (p int64, err error) {
+	if minValue > maxValue {
+		rb.Clear()
+		return 0, nil
+	}
+	stream := byteInputAdapterPool.Get().(*byteInputAdapter)
+	stream.reset(reader)
+
+	p, err = rb.highlowcontainer.readRangeFrom(stream, minValue, maxValue)
+	byteInputAdapterPool.Put(stream)
+
+	if err != nil {
+		rb.Clear()
+	}
+	return
+}
+
+// FromBufferRange is like FromBuffer but only keeps the integers in
+// [minValue, maxValue], skipping the other containers without decoding
+// them and trimming the ones at the boundaries. The untrimmed containers
+// refer to buf, with the same caveats as FromBuffer.
+// On error, the bitmap is left empty.
+func (rb *Bitmap) FromBufferRange(buf []byte, minValue, maxValue uint32) (p int64, err error) {
+	if minValue > maxValue {
+		rb.Clear()
+		return 0, nil
+	}
+	p, err = rb.highlowcontainer.fromBufferRange(buf, minValue, maxValue)
+	if err != nil {
+		rb.Clear()
+	}
+	return
+}
+
 var (
 	byteBufferPool = sync.Pool{
 		New: func() interface{} {
@@ -304,6 +378,91 @@ func newIntIterator(a *Bitmap) *intIterator {
 	return p
 }
 
+// RankIterable is an IntPeekable that keeps track of the rank of the next
+// value, so that iteration can be resumed later with SeekToRank
+type RankIterable interface {
+	IntPeekable
+	// Rank returns the number of values before the next one, the total
+	// cardinality once the iterator is exhausted
+	Rank() uint64
+	// SeekToRank moves the iterator so that the next value is the one
+	// preceded by n values, i.e., the value returned by Select(n)
+	SeekToRank(n uint64)
+}
+
+type rankIterator struct {
+	intIterator
+	rank uint64 // rank of the next value
+	base uint64 // rank of the first value of the container at pos
+}
+
+// Rank returns the number of values before the next one
+func (ri *rankIterator) Rank() uint64 {
+	return ri.rank
+}
+
+// Next returns the next integer
+func (ri *rankIterator) Next() uint32 {
+	pos := ri.pos
+	x := ri.intIterator.Next()
+	ri.rank++
+	if ri.pos != pos {
+		ri.base = ri.rank
+	}
+	return x
+}
+
+// AdvanceIfNeeded advances as long as the next value is smaller than minval
+func (ri *rankIterator) AdvanceIfNeeded(minval uint32) {
+	pos := ri.pos
+	ri.intIterator.AdvanceIfNeeded(minval)
+	for ; pos < ri.pos; pos++ {
+		ri.base += uint64(ri.highlowcontainer.getContainerAtIndex(pos).getCardinality())
+	}
+	ri.rank = ri.base
+	if ri.HasNext() {
+		// rank counts the values up to and including the next one
+		ri.rank += uint64(ri.highlowcontainer.getContainerAtIndex(ri.pos).rank(lowbits(ri.PeekNext()))) - 1
+	}
+}
+
+// SeekToRank moves the iterator so that the next value is the one preceded
+// by n values, it can move backward as well as forward
+func (ri *rankIterator) SeekToRank(n uint64) {
+	ra := ri.highlowcontainer
+	pos, base := 0, uint64(0)
+	if sums := ra.rankSums(); sums != nil {
+		pos = sort.Search(len(sums), func(i int) bool { return sums[i] > n })
+		if pos > 0 {
+			base = sums[pos-1]
+		}
+	} else {
+		for ; pos < ra.size(); pos++ {
+			card := uint64(ra.getContainerAtIndex(pos).getCardinality())
+			if base+card > n {
+				break
+			}
+			base += card
+		}
+	}
+	ri.pos = pos
+	ri.base = base
+	ri.rank = base
+	ri.init()
+	if ri.HasNext() {
+		c := ra.getContainerAtIndex(pos)
+		ri.iter.advanceIfNeeded(uint16(c.selectInt(uint16(n - base))))
+		ri.rank = n
+	}
+}
+
+func newRankIterator(a *Bitmap) *rankIterator {
+	p := new(rankIterator)
+	p.highlowcontainer = &a.highlowcontainer
+	p.init()
+	return p
+}
+
 type intReverseIterator struct {
 	pos              int
 	hs               uint32
@@ -428,12 +587,92 @@ func (rb *Bitmap) ReverseIterator() IntIterable {
 	return newIntReverseIterator(rb)
 }
 
+// RankIterator creates a new RankIterable to iterate over the integers contained in the bitmap, in sorted order;
+// the iterator becomes invalid if the bitmap is modified (e.g., with Add or Remove).
+func (rb *Bitmap) RankIterator() RankIterable {
+	return newRankIterator(rb)
+}
+
 // ManyIterator creates a new ManyIntIterable to iterate over the integers contained in the bitmap, in sorted order;
 // the iterator becomes invalid if the bitmap is modified (e.g., with Add or Remove).
 func (rb *Bitmap) ManyIterator() ManyIntIterable {
 	return newManyIntIterator(rb)
 }
 
+// Iterate calls cb on the integers contained in the bitmap, in sorted
+// order, until cb returns false. Unlike Iterator, it does not allocate.
+// The bitmap must not be modified by cb.
+func (rb *Bitmap) Iterate(cb func(x uint32) bool) {
+	ra := &rb.highlowcontainer
+	for i, c := range ra.containers {
+		hs := uint32(ra.keys[i]) << 16
+		switch t := c.(type) {
+		case *arrayContainer:
+			for _, v := range t.content {
+				if !cb(hs | uint32(v)) {
+					return
+				}
+			}
+		case *bitmapContainer:
+			for k, w := range t.bitmap {
+				base := hs | uint32(k*64)
+				for w != 0 {
+					if !cb(base | uint32(countTrailingZeros(w))) {
+						return
+					}
+					w &= w - 1
+				}
+			}
+		case *runContainer16:
+			for _, iv := range t.iv {
+				for v := uint32(iv.start); v <= uint32(iv.last()); v++ {
+					if !cb(hs | v) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// IterateReverse calls cb on the integers contained in the bitmap, in
+// decreasing order, until cb returns false. It does not allocate.
+// The bitmap must not be modified by cb.
+func (rb *Bitmap) IterateReverse(cb func(x uint32) bool) {
+	ra := &rb.highlowcontainer
+	for i := len(ra.containers) - 1; i >= 0; i-- {
+		hs := uint32(ra.keys[i]) << 16
+		switch t := ra.containers[i].(type) {
+		case *arrayContainer:
+			for j := len(t.content) - 1; j >= 0; j-- {
+				if !cb(hs | uint32(t.content[j])) {
+					return
+				}
+			}
+		case *bitmapContainer:
+			for k := len(t.bitmap) - 1; k >= 0; k-- {
+				base := hs | uint32(k*64)
+				for w := t.bitmap[k]; w != 0; {
+					bit := 63 - countLeadingZeros(w)
+					if !cb(base | uint32(bit)) {
+						return
+					}
+					w &^= uint64(1) << uint(bit)
+				}
+			}
+		case *runContainer16:
+			for j := len(t.iv) - 1; j >= 0; j-- {
+				start := uint32(t.iv[j].start)
+				for v := uint32(t.iv[j].last()) + 1; v > start; v-- {
+					if !cb(hs | (v - 1)) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
 // Clone creates a copy of the Bitmap
 func (rb *Bitmap) Clone() *Bitmap {
 	ptr := new(Bitmap)
@@ -639,6 +878,12 @@ func (rb *Bitmap) IsEmpty() bool {
 
 // GetCardinality returns the number of integers contained in the bitmap
 func (rb *Bitmap) GetCardinality() uint64 {
+	if sums := rb.highlowcontainer.rankSums(); sums != nil {
+		if len(sums) == 0 {
+			return 0
+		}
+		return sums[len(sums)-1]
+	}
 	size := uint64(0)
 	for _, c := range rb.highlowcontainer.containers {
 		size += uint64(c.getCardinality())
@@ -648,6 +893,21 @@ func (rb *Bitmap) GetCardinality() uint64 {
 
 // Rank returns the number of integers that are smaller or equal to x (Rank(infinity) would be GetCardinality())
 func (rb *Bitmap) Rank(x uint32) uint64 {
+	if sums := rb.highlowcontainer.rankSums(); sums != nil {
+		ra := &rb.highlowcontainer
+		i := ra.binarySearch(0, int64(ra.size()), highbits(x))
+		if i < 0 {
+			if i = -i - 1; i == 0 {
+				return 0
+			}
+			return sums[i-1]
+		}
+		size := uint64(ra.getContainerAtIndex(i).rank(lowbits(x)))
+		if i > 0 {
+			size += sums[i-1]
+		}
+		return size
+	}
 	size := uint64(0)
 	for i := 0; i < rb.highlowcontainer.size(); i++ {
 		key := rb.highlowcontainer.getKeyAtIndex(i)
@@ -663,8 +923,120 @@ func (rb *Bitmap) Rank(x uint32) uint64 {
 	return size
 }
 
+// rangeBounds converts [start, end) to the keys of its first and last
+// values, the second result is false if the range is empty
+func rangeBounds(start, end uint64) (uint32, uint32, bool) {
+	if end > MaxRange {
+		end = MaxRange
+	}
+	if start >= end {
+		return 0, 0, false
+	}
+	return uint32(start), uint32(end - 1), true
+}
+
+// containerRange returns the part of [first, last] that falls in the
+// container with the given key, as a [start,end) range of low bits
+func containerRange(key uint16, first, last uint32) (uint, uint) {
+	start, end := uint(0), uint(maxCapacity)
+	if key == highbits(first) {
+		start = uint(lowbits(first))
+	}
+	if key == highbits(last) {
+		end = uint(lowbits(last)) + 1
+	}
+	return start, end
+}
+
+// RangeCardinality returns the number of integers in [start, end)
+func (rb *Bitmap) RangeCardinality(start, end uint64) uint64 {
+	first, last, ok := rangeBounds(start, end)
+	if !ok {
+		return 0
+	}
+	ra := &rb.highlowcontainer
+	i := ra.binarySearch(0, int64(ra.size()), highbits(first))
+	if i < 0 {
+		i = -i - 1
+	}
+	answer := uint64(0)
+	for ; i < ra.size() && ra.getKeyAtIndex(i) <= highbits(last); i++ {
+		key := ra.getKeyAtIndex(i)
+		c := ra.getContainerAtIndex(i)
+		s, e := containerRange(key, first, last)
+		if s == 0 && e == maxCapacity {
+			answer += uint64(c.getCardinality())
+		} else {
+			answer += uint64(c.getCardinalityInRange(s, e))
+		}
+	}
+	return answer
+}
+
+// ContainsRange returns true if all the integers in [start, end) are in
+// the bitmap, an empty range is always contained
+func (rb *Bitmap) ContainsRange(start, end uint64) bool {
+	if end > MaxRange {
+		return false
+	}
+	first, last, ok := rangeBounds(start, end)
+	if !ok {
+		return true
+	}
+	ra := &rb.highlowcontainer
+	i := ra.binarySearch(0, int64(ra.size()), highbits(first))
+	if i < 0 {
+		return false
+	}
+	// keys are strictly increasing, so the range must cover consecutive keys
+	j := i + int(highbits(last)-highbits(first))
+	if j >= ra.size() || ra.getKeyAtIndex(j) != highbits(last) {
+		return false
+	}
+	for ; i <= j; i++ {
+		s, e := containerRange(ra.getKeyAtIndex(i), first, last)
+		if !ra.getContainerAtIndex(i).containsRange(s, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// IntersectsRange returns true if at least one integer in [start, end) is
+// in the bitmap
+func (rb *Bitmap) IntersectsRange(start, end uint64) bool {
+	first, last, ok := rangeBounds(start, end)
+	if !ok {
+		return false
+	}
+	ra := &rb.highlowcontainer
+	i := ra.binarySearch(0, int64(ra.size()), highbits(first))
+	if i < 0 {
+		i = -i - 1
+	}
+	for ; i < ra.size() && ra.getKeyAtIndex(i) <= highbits(last); i++ {
+		s, e := containerRange(ra.getKeyAtIndex(i), first, last)
+		if ra.getContainerAtIndex(i).intersectsRange(s, e) {
+			return true
+		}
+	}
+	return false
+}
+
 // Select returns the xth integer in the bitmap
 func (rb *Bitmap) Select(x uint32) (uint32, error) {
+	if sums := rb.highlowcontainer.rankSums(); sums != nil {
+		i := sort.Search(len(sums), func(i int) bool { return sums[i] > uint64(x) })
+		if i == len(sums) {
+			return 0, fmt.Errorf("can't find %dth integer in a bitmap with only %d items", x, rb.GetCardinality())
+		}
+		remaining := uint64(x)
+		if i > 0 {
+			remaining -= sums[i-1]
+		}
+		key := rb.highlowcontainer.getKeyAtIndex(i)
+		return uint32(key)<<16 + uint32(rb.highlowcontainer.getContainerAtIndex(i).selectInt(uint16(remaining))), nil
+	}
 	if rb.GetCardinality() <= uint64(x) {
 		return 0, fmt.Errorf("can't find %dth integer in a bitmap with only %d items", x, rb.GetCardinality())
 	}
@@ -682,6 +1054,22 @@ func (rb *Bitmap) Select(x uint32) (uint32, error) {
 	return 0, fmt.Errorf("can't find %dth integer in a bitmap with only %d items", x, rb.GetCardinality())
 }
 
+// SliceByRank returns the integers of the bitmap whose rank lies in
+// [from, to), i.e., the values Select(from) to Select(to-1), in sorted
+// order. The range is truncated to the cardinality of the bitmap.
+func (rb *Bitmap) SliceByRank(from, to uint64) []uint32 {
+	if from >= to {
+		return nil
+	}
+	it := newRankIterator(rb)
+	it.SeekToRank(from)
+	var answer []uint32
+	for it.rank < to && it.HasNext() {
+		answer = append(answer, it.Next())
+	}
+	return answer
+}
+
 // And computes the intersection between two bitmaps and stores the result in the current bitmap
 func (rb *Bitmap) And(x2 *Bitmap) {
 	pos1 := 0
@@ -831,6 +1219,107 @@ main:
 	return answer
 }
 
+// AndNotCardinality returns the cardinality of the difference between two
+// bitmaps, bitmaps are not modified
+func (rb *Bitmap) AndNotCardinality(x2 *Bitmap) uint64 {
+	pos2 := 0
+	answer := uint64(0)
+	length2 := x2.highlowcontainer.size()
+	for pos1 := 0; pos1 < rb.highlowcontainer.size(); pos1++ {
+		s1 := rb.highlowcontainer.getKeyAtIndex(pos1)
+		c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
+		if pos2 < length2 && x2.highlowcontainer.getKeyAtIndex(pos2) < s1 {
+			pos2 = x2.highlowcontainer.advanceUntil(s1, pos2)
+		}
+		if pos2 < length2 && x2.highlowcontainer.getKeyAtIndex(pos2) == s1 {
+			answer += uint64(andNotCardinality(c1, x2.highlowcontainer.getContainerAtIndex(pos2)))
+		} else {
+			answer += uint64(c1.getCardinality())
+		}
+	}
+	return answer
+}
+
+// XorCardinality returns the cardinality of the symmetric difference
+// between two bitmaps, bitmaps are not modified
+func (rb *Bitmap) XorCardinality(x2 *Bitmap) uint64 {
+	pos1 := 0
+	pos2 := 0
+	length1 := rb.highlowcontainer.size()
+	length2 := x2.highlowcontainer.size()
+	answer := uint64(0)
+	for pos1 < length1 && pos2 < length2 {
+		s1 := rb.highlowcontainer.getKeyAtIndex(pos1)
+		s2 := x2.highlowcontainer.getKeyAtIndex(pos2)
+		if s1 < s2 {
+			answer += uint64(rb.highlowcontainer.getContainerAtIndex(pos1).getCardinality())
+			pos1++
+		} else if s1 > s2 {
+			answer += uint64(x2.highlowcontainer.getContainerAtIndex(pos2).getCardinality())
+			pos2++
+		} else {
+			c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
+			c2 := x2.highlowcontainer.getContainerAtIndex(pos2)
+			answer += uint64(xorCardinality(c1, c2))
+			pos1++
+			pos2++
+		}
+	}
+	for ; pos1 < length1; pos1++ {
+		answer += uint64(rb.highlowcontainer.getContainerAtIndex(pos1).getCardinality())
+	}
+	for ; pos2 < length2; pos2++ {
+		answer += uint64(x2.highlowcontainer.getContainerAtIndex(pos2).getCardinality())
+	}
+	return answer
+}
+
+// andNotCardinality returns the cardinality of c1 minus c2
+func andNotCardinality(c1, c2 container) int {
+	if b1, ok := c1.(*bitmapContainer); ok {
+		if b2, ok := c2.(*bitmapContainer); ok {
+			return int(popcntMaskSlice(b1.bitmap, b2.bitmap))
+		}
+	}
+	return c1.getCardinality() - c1.andCardinality(c2)
+}
+
+// xorCardinality returns the cardinality of c1 xor c2
+func xorCardinality(c1, c2 container) int {
+	if b1, ok := c1.(*bitmapContainer); ok {
+		if b2, ok := c2.(*bitmapContainer); ok {
+			return int(popcntXorSlice(b1.bitmap, b2.bitmap))
+		}
+	}
+	return c1.getCardinality() + c2.getCardinality() - 2*c1.andCardinality(c2)
+}
+
+// Jaccard returns the Jaccard index of two bitmaps, the cardinality of
+// their intersection divided by the cardinality of their union, without
+// computing either of them. It is 0 when both bitmaps are empty.
+func Jaccard(x1, x2 *Bitmap) float64 {
+	inter := x1.AndCardinality(x2)
+	union := x1.GetCardinality() + x2.GetCardinality() - inter
+	if union == 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
+
+// Overlap returns the overlap coefficient of two bitmaps, the cardinality
+// of their intersection divided by the smallest of their cardinalities.
+// It is 0 when either bitmap is empty.
+func Overlap(x1, x2 *Bitmap) float64 {
+	c1, c2 := x1.GetCardinality(), x2.GetCardinality()
+	if c2 < c1 {
+		c1 = c2
+	}
+	if c1 == 0 {
+		return 0
+	}
+	return float64(x1.AndCardinality(x2)) / float64(c1)
+}
+
 // Intersects checks whether two bitmap intersects, bitmaps are not modified
 func (rb *Bitmap) Intersects(x2 *Bitmap) bool {
 	pos1 := 0
@@ -1227,6 +1716,117 @@ func (rb *Bitmap) AddMany(dat []uint32) {
 	}
 }
 
+// AddManyUnsorted adds all of the values in dat, which may come in any
+// order. A single pass partitions the values by their high bits, then each
+// container is built at once from its group of low bits. The slice dat is
+// not modified.
+func (rb *Bitmap) AddManyUnsorted(dat []uint32) {
+	if len(dat) < unsortedPartitionMinSize {
+		// too few values to pay for the partitioning
+		rb.AddMany(dat)
+		return
+	}
+	minKey, maxKey := highbits(dat[0]), highbits(dat[0])
+	for _, v := range dat[1:] {
+		if hb := highbits(v); hb < minKey {
+			minKey = hb
+		} else if hb > maxKey {
+			maxKey = hb
+		}
+	}
+	// ends[k] becomes the end of the group of key minKey+k in lows
+	ends := make([]uint32, int(maxKey-minKey)+2)
+	for _, v := range dat {
+		ends[int(highbits(v)-minKey)+1]++
+	}
+	for k := 1; k < len(ends); k++ {
+		ends[k] += ends[k-1]
+	}
+	lows := make([]uint16, len(dat))
+	for _, v := range dat {
+		k := highbits(v) - minKey
+		lows[ends[k]] = lowbits(v)
+		ends[k]++
+	}
+
+	var keys []uint16
+	var containers []container
+	start := uint32(0)
+	for k, end := range ends[:len(ends)-1] {
+		if end > start {
+			keys = append(keys, minKey+uint16(k))
+			containers = append(containers, containerOfUnsorted(lows[start:end]))
+		}
+		start = end
+	}
+	rb.highlowcontainer.mergeContainers(keys, containers)
+}
+
+// unsortedPartitionMinSize is the number of values from which
+// AddManyUnsorted partitions them rather than calling AddMany
+const unsortedPartitionMinSize = 64
+
+// mergeContainers ORs the containers, sorted by key, into the array
+func (ra *roaringArray) mergeContainers(newKeys []uint16, newContainers []container) {
+	size := ra.size()
+	keys := make([]uint16, 0, size+len(newKeys))
+	containers := make([]container, 0, size+len(newKeys))
+	needCopyOnWrite := make([]bool, 0, size+len(newKeys))
+	pos := 0
+	for i, key := range newKeys {
+		for ; pos < size && ra.getKeyAtIndex(pos) < key; pos++ {
+			keys = append(keys, ra.keys[pos])
+			containers = append(containers, ra.containers[pos])
+			needCopyOnWrite = append(needCopyOnWrite, ra.needCopyOnWrite[pos])
+		}
+		c := newContainers[i]
+		if pos < size && ra.getKeyAtIndex(pos) == key {
+			c = ra.getWritableContainerAtIndex(pos).ior(c)
+			pos++
+		}
+		keys = append(keys, key)
+		containers = append(containers, c)
+		needCopyOnWrite = append(needCopyOnWrite, false)
+	}
+	keys = append(keys, ra.keys[pos:]...)
+	containers = append(containers, ra.containers[pos:]...)
+	needCopyOnWrite = append(needCopyOnWrite, ra.needCopyOnWrite[pos:]...)
+	ra.keys = keys
+	ra.containers = containers
+	ra.needCopyOnWrite = needCopyOnWrite
+	ra.invalidateRankIndex()
+}
+
+// containerOfUnsorted builds a container from low bits in any order,
+// duplicates allowed; lows is reordered
+func containerOfUnsorted(lows []uint16) container {
+	if len(lows) > arrayDefaultMaxSize {
+		bc := newBitmapContainer()
+		for _, x := range lows {
+			bc.bitmap[x>>6] |= uint64(1) << (x & 63)
+		}
+		bc.computeCardinality()
+		if bc.cardinality <= arrayDefaultMaxSize {
+			return bc.toArrayContainer()
+		}
+		return bc
+	}
+	sort.Sort(uint16Slice(lows))
+	n := 0
+	for i, x := range lows {
+		if i == 0 || x != lows[i-1] {
+			n++
+		}
+	}
+	content := make([]uint16, 0, n)
+	for i, x := range lows {
+		if i == 0 || x != lows[i-1] {
+			content = append(content, x)
+		}
+	}
+	return &arrayContainer{content}
+}
+
 // BitmapOf generates a new bitmap filled with the specified integers
 func BitmapOf(dat ...uint32) *Bitmap {
 	ans := NewBitmap()
@@ -1461,6 +2061,25 @@ func (rb *Bitmap) GetCopyOnWrite() (val bool) {
 	return rb.highlowcontainer.copyOnWrite
 }
 
+// SetRankIndex enables or disables the rank index of this bitmap. The
+// index caches the cumulative cardinalities of the containers so that
+// Rank and Select run in logarithmic time and GetCardinality in constant
+// time. It is rebuilt by the first of these calls following a mutation;
+// as with any read, these calls are safe to run concurrently.
+func (rb *Bitmap) SetRankIndex(val bool) {
+	if !val {
+		rb.highlowcontainer.rank = nil
+	} else if rb.highlowcontainer.rank == nil {
+		rb.highlowcontainer.rank = newRankIndex()
+		rb.highlowcontainer.rankSums()
+	}
+}
+
+// GetRankIndex returns true if the rank index of this bitmap is enabled
+func (rb *Bitmap) GetRankIndex() (val bool) {
+	return rb.highlowcontainer.rank != nil
+}
+
 // CloneCopyOnWriteContainers clones all containers which have
 // needCopyOnWrite set to true.
 // This can be used to make sure it is safe to munmap a []byte
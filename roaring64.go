@@ -0,0 +1,780 @@
+package roaring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Bitmap64 represents a compressed bitmap of 64-bit integers.
+// The most significant 32 bits of each value select an inner
+// 32-bit Bitmap which holds the least significant 32 bits.
+type Bitmap64 struct {
+	keys    []uint32
+	bitmaps []*Bitmap
+}
+
+// NewBitmap64 creates a new empty Bitmap64
+func NewBitmap64() *Bitmap64 {
+	return &Bitmap64{}
+}
+
+// Bitmap64Of generates a new 64-bit bitmap filled with the specified integers
+func Bitmap64Of(dat ...uint64) *Bitmap64 {
+	ans := NewBitmap64()
+	ans.AddMany(dat)
+	return ans
+}
+
+func highbits64(x uint64) uint32 {
+	return uint32(x >> 32)
+}
+
+func lowbits64(x uint64) uint32 {
+	return uint32(x)
+}
+
+// getIndex returns the index of the key, or -(insertion point)-1 if absent
+func (rb *Bitmap64) getIndex(key uint32) int {
+	size := len(rb.keys)
+	if size == 0 || rb.keys[size-1] == key {
+		return size - 1
+	}
+	low, high := 0, size-1
+	for low <= high {
+		middle := int(uint(low+high) >> 1)
+		if rb.keys[middle] < key {
+			low = middle + 1
+		} else if rb.keys[middle] > key {
+			high = middle - 1
+		} else {
+			return middle
+		}
+	}
+	return -(low + 1)
+}
+
+func (rb *Bitmap64) insertAt(i int, key uint32, bm *Bitmap) {
+	rb.keys = append(rb.keys, 0)
+	rb.bitmaps = append(rb.bitmaps, nil)
+	copy(rb.keys[i+1:], rb.keys[i:])
+	copy(rb.bitmaps[i+1:], rb.bitmaps[i:])
+	rb.keys[i] = key
+	rb.bitmaps[i] = bm
+}
+
+func (rb *Bitmap64) removeAt(i int) {
+	copy(rb.keys[i:], rb.keys[i+1:])
+	copy(rb.bitmaps[i:], rb.bitmaps[i+1:])
+	rb.bitmaps[len(rb.bitmaps)-1] = nil
+	rb.keys = rb.keys[:len(rb.keys)-1]
+	rb.bitmaps = rb.bitmaps[:len(rb.bitmaps)-1]
+}
+
+// getOrCreate returns the inner bitmap for key, creating it if needed
+func (rb *Bitmap64) getOrCreate(key uint32) *Bitmap {
+	i := rb.getIndex(key)
+	if i >= 0 {
+		return rb.bitmaps[i]
+	}
+	bm := NewBitmap()
+	rb.insertAt(-i-1, key, bm)
+	return bm
+}
+
+// Add the integer x to the bitmap
+func (rb *Bitmap64) Add(x uint64) {
+	rb.getOrCreate(highbits64(x)).Add(lowbits64(x))
+}
+
+// CheckedAdd adds the integer x to the bitmap and return true if it was added (false if the integer was already present)
+func (rb *Bitmap64) CheckedAdd(x uint64) bool {
+	return rb.getOrCreate(highbits64(x)).CheckedAdd(lowbits64(x))
+}
+
+// AddMany add all of the values in dat
+func (rb *Bitmap64) AddMany(dat []uint64) {
+	if len(dat) == 0 {
+		return
+	}
+	prev := dat[0]
+	bm := rb.getOrCreate(highbits64(prev))
+	for _, x := range dat {
+		if highbits64(x) != highbits64(prev) {
+			bm = rb.getOrCreate(highbits64(x))
+		}
+		bm.Add(lowbits64(x))
+		prev = x
+	}
+}
+
+// AddRange adds the integers in [rangeStart, rangeEnd) to the bitmap.
+func (rb *Bitmap64) AddRange(rangeStart, rangeEnd uint64) {
+	if rangeStart >= rangeEnd {
+		return
+	}
+	hbStart := highbits64(rangeStart)
+	hbLast := highbits64(rangeEnd - 1)
+	for hb := uint64(hbStart); hb <= uint64(hbLast); hb++ {
+		containerStart := uint64(0)
+		if hb == uint64(hbStart) {
+			containerStart = uint64(lowbits64(rangeStart))
+		}
+		containerEnd := MaxRange
+		if hb == uint64(hbLast) {
+			containerEnd = uint64(lowbits64(rangeEnd-1)) + 1
+		}
+		rb.getOrCreate(uint32(hb)).AddRange(containerStart, containerEnd)
+	}
+}
+
+// Remove the integer x from the bitmap
+func (rb *Bitmap64) Remove(x uint64) {
+	rb.CheckedRemove(x)
+}
+
+// CheckedRemove removes the integer x from the bitmap and return true if the integer was effectively remove (and false if the integer was not present)
+func (rb *Bitmap64) CheckedRemove(x uint64) bool {
+	i := rb.getIndex(highbits64(x))
+	if i < 0 {
+		return false
+	}
+	removed := rb.bitmaps[i].CheckedRemove(lowbits64(x))
+	if rb.bitmaps[i].IsEmpty() {
+		rb.removeAt(i)
+	}
+	return removed
+}
+
+// RemoveRange removes the integers in [rangeStart, rangeEnd) from the bitmap.
+func (rb *Bitmap64) RemoveRange(rangeStart, rangeEnd uint64) {
+	if rangeStart >= rangeEnd {
+		return
+	}
+	hbStart := highbits64(rangeStart)
+	hbLast := highbits64(rangeEnd - 1)
+	for i := 0; i < len(rb.keys); {
+		key := rb.keys[i]
+		if key < hbStart {
+			i++
+			continue
+		}
+		if key > hbLast {
+			break
+		}
+		containerStart := uint64(0)
+		if key == hbStart {
+			containerStart = uint64(lowbits64(rangeStart))
+		}
+		containerEnd := MaxRange
+		if key == hbLast {
+			containerEnd = uint64(lowbits64(rangeEnd-1)) + 1
+		}
+		rb.bitmaps[i].RemoveRange(containerStart, containerEnd)
+		if rb.bitmaps[i].IsEmpty() {
+			rb.removeAt(i)
+		} else {
+			i++
+		}
+	}
+}
+
+// Contains returns true if the integer is contained in the bitmap
+func (rb *Bitmap64) Contains(x uint64) bool {
+	i := rb.getIndex(highbits64(x))
+	return i >= 0 && rb.bitmaps[i].Contains(lowbits64(x))
+}
+
+// IsEmpty returns true if the Bitmap64 is empty
+func (rb *Bitmap64) IsEmpty() bool {
+	return len(rb.keys) == 0
+}
+
+// Clear resets the Bitmap64 to be logically empty
+func (rb *Bitmap64) Clear() {
+	for i := range rb.bitmaps {
+		rb.bitmaps[i] = nil
+	}
+	rb.keys = rb.keys[:0]
+	rb.bitmaps = rb.bitmaps[:0]
+}
+
+// GetCardinality returns the number of integers contained in the bitmap
+func (rb *Bitmap64) GetCardinality() uint64 {
+	size := uint64(0)
+	for _, bm := range rb.bitmaps {
+		size += bm.GetCardinality()
+	}
+	return size
+}
+
+// Minimum get the smallest value stored in this bitmap, assumes that it is not empty
+func (rb *Bitmap64) Minimum() uint64 {
+	return uint64(rb.keys[0])<<32 | uint64(rb.bitmaps[0].Minimum())
+}
+
+// Maximum get the largest value stored in this bitmap, assumes that it is not empty
+func (rb *Bitmap64) Maximum() uint64 {
+	last := len(rb.keys) - 1
+	return uint64(rb.keys[last])<<32 | uint64(rb.bitmaps[last].Maximum())
+}
+
+// Rank returns the number of integers that are smaller or equal to x (Rank(infinity) would be GetCardinality())
+func (rb *Bitmap64) Rank(x uint64) uint64 {
+	size := uint64(0)
+	hb := highbits64(x)
+	for i, key := range rb.keys {
+		if key > hb {
+			return size
+		}
+		if key < hb {
+			size += rb.bitmaps[i].GetCardinality()
+		} else {
+			return size + rb.bitmaps[i].Rank(lowbits64(x))
+		}
+	}
+	return size
+}
+
+// Select returns the xth integer in the bitmap
+func (rb *Bitmap64) Select(x uint64) (uint64, error) {
+	remaining := x
+	for i, bm := range rb.bitmaps {
+		card := bm.GetCardinality()
+		if remaining >= card {
+			remaining -= card
+			continue
+		}
+		low, err := bm.Select(uint32(remaining))
+		if err != nil {
+			return 0, err
+		}
+		return uint64(rb.keys[i])<<32 | uint64(low), nil
+	}
+	return 0, fmt.Errorf("can't find %dth integer in a bitmap with only %d items", x, rb.GetCardinality())
+}
+
+// Clone creates a copy of the Bitmap64
+func (rb *Bitmap64) Clone() *Bitmap64 {
+	answer := &Bitmap64{
+		keys:    make([]uint32, len(rb.keys)),
+		bitmaps: make([]*Bitmap, len(rb.bitmaps)),
+	}
+	copy(answer.keys, rb.keys)
+	for i, bm := range rb.bitmaps {
+		answer.bitmaps[i] = bm.Clone()
+	}
+	return answer
+}
+
+// Equals returns true if the two bitmaps contain the same integers
+func (rb *Bitmap64) Equals(o interface{}) bool {
+	srb, ok := o.(*Bitmap64)
+	if !ok || len(srb.keys) != len(rb.keys) {
+		return false
+	}
+	for i, key := range rb.keys {
+		if key != srb.keys[i] || !rb.bitmaps[i].Equals(srb.bitmaps[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ToArray creates a new slice containing all of the integers stored in the Bitmap64 in sorted order
+func (rb *Bitmap64) ToArray() []uint64 {
+	array := make([]uint64, 0, rb.GetCardinality())
+	for i, bm := range rb.bitmaps {
+		hs := uint64(rb.keys[i]) << 32
+		for _, low := range bm.ToArray() {
+			array = append(array, hs|uint64(low))
+		}
+	}
+	return array
+}
+
+// String creates a string representation of the Bitmap64
+func (rb *Bitmap64) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("{")
+	i := rb.Iterator()
+	counter := 0
+	for i.HasNext() {
+		if counter > 0 {
+			buffer.WriteString(",")
+		}
+		counter++
+		// to avoid exhausting the memory
+		if counter > 0x40000 {
+			buffer.WriteString("...")
+			break
+		}
+		buffer.WriteString(strconv.FormatUint(i.Next(), 10))
+	}
+	buffer.WriteString("}")
+	return buffer.String()
+}
+
+// RunOptimize attempts to further compress the runs of consecutive values found in the bitmap
+func (rb *Bitmap64) RunOptimize() {
+	for _, bm := range rb.bitmaps {
+		bm.RunOptimize()
+	}
+}
+
+// GetSizeInBytes estimates the memory usage of the Bitmap64.
+func (rb *Bitmap64) GetSizeInBytes() uint64 {
+	size := uint64(8)
+	for _, bm := range rb.bitmaps {
+		size += 4 + bm.GetSizeInBytes()
+	}
+	return size
+}
+
+// Intersects checks whether two bitmap intersects, bitmaps are not modified
+func (rb *Bitmap64) Intersects(x2 *Bitmap64) bool {
+	pos1, pos2 := 0, 0
+	for pos1 < len(rb.keys) && pos2 < len(x2.keys) {
+		s1, s2 := rb.keys[pos1], x2.keys[pos2]
+		if s1 < s2 {
+			pos1++
+		} else if s1 > s2 {
+			pos2++
+		} else {
+			if rb.bitmaps[pos1].Intersects(x2.bitmaps[pos2]) {
+				return true
+			}
+			pos1++
+			pos2++
+		}
+	}
+	return false
+}
+
+// AndCardinality returns the cardinality of the intersection between two bitmaps, bitmaps are not modified
+func (rb *Bitmap64) AndCardinality(x2 *Bitmap64) uint64 {
+	answer := uint64(0)
+	pos1, pos2 := 0, 0
+	for pos1 < len(rb.keys) && pos2 < len(x2.keys) {
+		s1, s2 := rb.keys[pos1], x2.keys[pos2]
+		if s1 < s2 {
+			pos1++
+		} else if s1 > s2 {
+			pos2++
+		} else {
+			answer += rb.bitmaps[pos1].AndCardinality(x2.bitmaps[pos2])
+			pos1++
+			pos2++
+		}
+	}
+	return answer
+}
+
+// And computes the intersection between two bitmaps and stores the result in the current bitmap
+func (rb *Bitmap64) And(x2 *Bitmap64) {
+	pos1, pos2 := 0, 0
+	intersectionsize := 0
+	for pos1 < len(rb.keys) && pos2 < len(x2.keys) {
+		s1, s2 := rb.keys[pos1], x2.keys[pos2]
+		if s1 < s2 {
+			pos1++
+		} else if s1 > s2 {
+			pos2++
+		} else {
+			bm := rb.bitmaps[pos1]
+			bm.And(x2.bitmaps[pos2])
+			if !bm.IsEmpty() {
+				rb.keys[intersectionsize] = s1
+				rb.bitmaps[intersectionsize] = bm
+				intersectionsize++
+			}
+			pos1++
+			pos2++
+		}
+	}
+	rb.resize(intersectionsize)
+}
+
+// AndNot computes the difference between two bitmaps and stores the result in the current bitmap
+func (rb *Bitmap64) AndNot(x2 *Bitmap64) {
+	pos1, pos2 := 0, 0
+	size := 0
+	for pos1 < len(rb.keys) {
+		s1 := rb.keys[pos1]
+		for pos2 < len(x2.keys) && x2.keys[pos2] < s1 {
+			pos2++
+		}
+		bm := rb.bitmaps[pos1]
+		if pos2 < len(x2.keys) && x2.keys[pos2] == s1 {
+			bm.AndNot(x2.bitmaps[pos2])
+		}
+		if !bm.IsEmpty() {
+			rb.keys[size] = s1
+			rb.bitmaps[size] = bm
+			size++
+		}
+		pos1++
+	}
+	rb.resize(size)
+}
+
+// Or computes the union between two bitmaps and stores the result in the current bitmap
+func (rb *Bitmap64) Or(x2 *Bitmap64) {
+	pos1, pos2 := 0, 0
+	for pos1 < len(rb.keys) && pos2 < len(x2.keys) {
+		s1, s2 := rb.keys[pos1], x2.keys[pos2]
+		if s1 < s2 {
+			pos1++
+		} else if s1 > s2 {
+			rb.insertAt(pos1, s2, x2.bitmaps[pos2].Clone())
+			pos1++
+			pos2++
+		} else {
+			rb.bitmaps[pos1].Or(x2.bitmaps[pos2])
+			pos1++
+			pos2++
+		}
+	}
+	for ; pos2 < len(x2.keys); pos2++ {
+		rb.keys = append(rb.keys, x2.keys[pos2])
+		rb.bitmaps = append(rb.bitmaps, x2.bitmaps[pos2].Clone())
+	}
+}
+
+// Xor computes the symmetric difference between two bitmaps and stores the result in the current bitmap
+func (rb *Bitmap64) Xor(x2 *Bitmap64) {
+	pos1, pos2 := 0, 0
+	for pos1 < len(rb.keys) && pos2 < len(x2.keys) {
+		s1, s2 := rb.keys[pos1], x2.keys[pos2]
+		if s1 < s2 {
+			pos1++
+		} else if s1 > s2 {
+			rb.insertAt(pos1, s2, x2.bitmaps[pos2].Clone())
+			pos1++
+			pos2++
+		} else {
+			rb.bitmaps[pos1] = Xor(rb.bitmaps[pos1], x2.bitmaps[pos2])
+			if rb.bitmaps[pos1].IsEmpty() {
+				rb.removeAt(pos1)
+			} else {
+				pos1++
+			}
+			pos2++
+		}
+	}
+	for ; pos2 < len(x2.keys); pos2++ {
+		rb.keys = append(rb.keys, x2.keys[pos2])
+		rb.bitmaps = append(rb.bitmaps, x2.bitmaps[pos2].Clone())
+	}
+}
+
+func (rb *Bitmap64) resize(newsize int) {
+	for k := newsize; k < len(rb.bitmaps); k++ {
+		rb.bitmaps[k] = nil
+	}
+	rb.keys = rb.keys[:newsize]
+	rb.bitmaps = rb.bitmaps[:newsize]
+}
+
+// Or64 computes the union between two 64-bit bitmaps and returns the result
+func Or64(x1, x2 *Bitmap64) *Bitmap64 {
+	answer := x1.Clone()
+	answer.Or(x2)
+	return answer
+}
+
+// And64 computes the intersection between two 64-bit bitmaps and returns the result
+func And64(x1, x2 *Bitmap64) *Bitmap64 {
+	answer := NewBitmap64()
+	pos1, pos2 := 0, 0
+	for pos1 < len(x1.keys) && pos2 < len(x2.keys) {
+		s1, s2 := x1.keys[pos1], x2.keys[pos2]
+		if s1 < s2 {
+			pos1++
+		} else if s1 > s2 {
+			pos2++
+		} else {
+			bm := And(x1.bitmaps[pos1], x2.bitmaps[pos2])
+			if !bm.IsEmpty() {
+				answer.keys = append(answer.keys, s1)
+				answer.bitmaps = append(answer.bitmaps, bm)
+			}
+			pos1++
+			pos2++
+		}
+	}
+	return answer
+}
+
+// Xor64 computes the symmetric difference between two 64-bit bitmaps and returns the result
+func Xor64(x1, x2 *Bitmap64) *Bitmap64 {
+	answer := x1.Clone()
+	answer.Xor(x2)
+	return answer
+}
+
+// AndNot64 computes the difference between two 64-bit bitmaps and returns the result
+func AndNot64(x1, x2 *Bitmap64) *Bitmap64 {
+	answer := x1.Clone()
+	answer.AndNot(x2)
+	return answer
+}
+
+// IntIterable64 allows you to iterate over the values in a Bitmap64
+type IntIterable64 interface {
+	HasNext() bool
+	Next() uint64
+}
+
+// IntPeekable64 allows you to look at the next value without advancing and
+// advance as long as the next value is smaller than minval
+type IntPeekable64 interface {
+	IntIterable64
+	// PeekNext peeks the next value without advancing the iterator
+	PeekNext() uint64
+	// AdvanceIfNeeded advances as long as the next value is smaller than minval
+	AdvanceIfNeeded(minval uint64)
+}
+
+type intIterator64 struct {
+	pos  int
+	hs   uint64
+	iter IntPeekable
+	rb   *Bitmap64
+}
+
+func (ii *intIterator64) init() {
+	if ii.pos < len(ii.rb.keys) {
+		ii.iter = ii.rb.bitmaps[ii.pos].Iterator()
+		ii.hs = uint64(ii.rb.keys[ii.pos]) << 32
+	}
+}
+
+// HasNext returns true if there are more integers to iterate over
+func (ii *intIterator64) HasNext() bool {
+	return ii.pos < len(ii.rb.keys)
+}
+
+// Next returns the next integer
+func (ii *intIterator64) Next() uint64 {
+	x := uint64(ii.iter.Next()) | ii.hs
+	if !ii.iter.HasNext() {
+		ii.pos++
+		ii.init()
+	}
+	return x
+}
+
+// PeekNext peeks the next value without advancing the iterator
+func (ii *intIterator64) PeekNext() uint64 {
+	return uint64(ii.iter.PeekNext()) | ii.hs
+}
+
+// AdvanceIfNeeded advances as long as the next value is smaller than minval
+func (ii *intIterator64) AdvanceIfNeeded(minval uint64) {
+	to := highbits64(minval)
+
+	for ii.HasNext() && ii.rb.keys[ii.pos] < to {
+		ii.pos++
+		ii.init()
+	}
+
+	if ii.HasNext() && ii.rb.keys[ii.pos] == to {
+		ii.iter.AdvanceIfNeeded(lowbits64(minval))
+
+		if !ii.iter.HasNext() {
+			ii.pos++
+			ii.init()
+		}
+	}
+}
+
+type intReverseIterator64 struct {
+	pos  int
+	hs   uint64
+	iter IntIterable
+	rb   *Bitmap64
+}
+
+func (ii *intReverseIterator64) init() {
+	if ii.pos >= 0 {
+		ii.iter = ii.rb.bitmaps[ii.pos].ReverseIterator()
+		ii.hs = uint64(ii.rb.keys[ii.pos]) << 32
+	} else {
+		ii.iter = nil
+	}
+}
+
+// HasNext returns true if there are more integers to iterate over
+func (ii *intReverseIterator64) HasNext() bool {
+	return ii.pos >= 0
+}
+
+// Next returns the next integer
+func (ii *intReverseIterator64) Next() uint64 {
+	x := uint64(ii.iter.Next()) | ii.hs
+	if !ii.iter.HasNext() {
+		ii.pos--
+		ii.init()
+	}
+	return x
+}
+
+// Iterator creates a new IntPeekable64 to iterate over the integers contained in the bitmap, in sorted order;
+// the iterator becomes invalid if the bitmap is modified (e.g., with Add or Remove).
+func (rb *Bitmap64) Iterator() IntPeekable64 {
+	p := &intIterator64{rb: rb}
+	p.init()
+	return p
+}
+
+// ReverseIterator creates a new IntIterable64 to iterate over the integers contained in the bitmap, in decreasing order;
+// the iterator becomes invalid if the bitmap is modified (e.g., with Add or Remove).
+func (rb *Bitmap64) ReverseIterator() IntIterable64 {
+	p := &intReverseIterator64{rb: rb, pos: len(rb.keys) - 1}
+	p.init()
+	return p
+}
+
+// GetSerializedSizeInBytes computes the serialized size in bytes
+// of the Bitmap64. It should correspond to the
+// number of bytes written when invoking WriteTo.
+func (rb *Bitmap64) GetSerializedSizeInBytes() uint64 {
+	size := uint64(8)
+	for _, bm := range rb.bitmaps {
+		size += 4 + bm.GetSerializedSizeInBytes()
+	}
+	return size
+}
+
+// WriteTo writes a serialized version of this bitmap to stream.
+// The format is the portable 64-bit extension of the RoaringFormatSpec,
+// shared with CRoaring and Java's Roaring64NavigableMap:
+// the number of 32-bit bitmaps as a little-endian uint64, then
+// for each bitmap its 32-bit high key followed by the bitmap
+// in the 32-bit portable format.
+// https://github.com/RoaringBitmap/RoaringFormatSpec#extension-for-64-bit-implementations
+func (rb *Bitmap64) WriteTo(stream io.Writer) (int64, error) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(len(rb.keys)))
+	written, err := stream.Write(buf[:])
+	n := int64(written)
+	if err != nil {
+		return n, err
+	}
+	for i, key := range rb.keys {
+		binary.LittleEndian.PutUint32(buf[:4], key)
+		written, err = stream.Write(buf[:4])
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+		w, err := rb.bitmaps[i].WriteTo(stream)
+		n += w
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ToBytes returns an array of bytes corresponding to what is written
+// when calling WriteTo
+func (rb *Bitmap64) ToBytes() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := rb.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// ReadFrom reads a serialized version of this bitmap from stream.
+// The format is the one written by WriteTo.
+func (rb *Bitmap64) ReadFrom(stream io.Reader) (int64, error) {
+	rb.Clear()
+	var buf [8]byte
+	read, err := io.ReadFull(stream, buf[:])
+	n := int64(read)
+	if err != nil {
+		return n, fmt.Errorf("error in Bitmap64.ReadFrom: could not read number of bitmaps: %s", err)
+	}
+	size := binary.LittleEndian.Uint64(buf[:])
+	if size > MaxUint32+1 {
+		return n, fmt.Errorf("it is logically impossible to have more than (1<<32) bitmaps")
+	}
+	for i := uint64(0); i < size; i++ {
+		read, err = io.ReadFull(stream, buf[:4])
+		n += int64(read)
+		if err != nil {
+			return n, fmt.Errorf("error in Bitmap64.ReadFrom: could not read key of bitmap %d: %s", i, err)
+		}
+		key := binary.LittleEndian.Uint32(buf[:4])
+		bm := NewBitmap()
+		r, err := bm.ReadFrom(stream)
+		n += r
+		if err != nil {
+			return n, err
+		}
+		if err := rb.appendDeserialized(key, bm); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// FromBuffer creates a bitmap from its serialized version stored in buffer.
+// The same caveats as for Bitmap.FromBuffer apply: buf is expected to be
+// a constant and to outlive the bitmap.
+func (rb *Bitmap64) FromBuffer(buf []byte) (int64, error) {
+	rb.Clear()
+	if len(buf) < 8 {
+		return 0, fmt.Errorf("error in Bitmap64.FromBuffer: could not read number of bitmaps: %s", io.ErrUnexpectedEOF)
+	}
+	size := binary.LittleEndian.Uint64(buf)
+	if size > MaxUint32+1 {
+		return 8, fmt.Errorf("it is logically impossible to have more than (1<<32) bitmaps")
+	}
+	n := int64(8)
+	for i := uint64(0); i < size; i++ {
+		if int64(len(buf))-n < 4 {
+			return n, fmt.Errorf("error in Bitmap64.FromBuffer: could not read key of bitmap %d: %s", i, io.ErrUnexpectedEOF)
+		}
+		key := binary.LittleEndian.Uint32(buf[n:])
+		n += 4
+		bm := NewBitmap()
+		r, err := bm.FromBuffer(buf[n:])
+		n += r
+		if err != nil {
+			return n, err
+		}
+		if err := rb.appendDeserialized(key, bm); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (rb *Bitmap64) appendDeserialized(key uint32, bm *Bitmap) error {
+	if len(rb.keys) > 0 && rb.keys[len(rb.keys)-1] >= key {
+		return fmt.Errorf("malformed 64-bit bitmap: keys are not strictly increasing (%d after %d)", key, rb.keys[len(rb.keys)-1])
+	}
+	if bm.IsEmpty() {
+		// other implementations may write empty bitmaps, we do not keep them
+		return nil
+	}
+	rb.keys = append(rb.keys, key)
+	rb.bitmaps = append(rb.bitmaps, bm)
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface for the bitmap
+// (same as ToBytes)
+func (rb *Bitmap64) MarshalBinary() ([]byte, error) {
+	return rb.ToBytes()
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface for the bitmap
+func (rb *Bitmap64) UnmarshalBinary(data []byte) error {
+	_, err := rb.ReadFrom(bytes.NewReader(data))
+	return err
+}
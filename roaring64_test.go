@@ -0,0 +1,255 @@
+package roaring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomBitmap64(r *rand.Rand, n int) (*Bitmap64, map[uint64]bool) {
+	rb := NewBitmap64()
+	m := make(map[uint64]bool)
+	for i := 0; i < n; i++ {
+		x := uint64(r.Intn(4))<<32 | uint64(r.Intn(300000))
+		rb.Add(x)
+		m[x] = true
+	}
+	return rb, m
+}
+
+func sortedKeys64(m map[uint64]bool) []uint64 {
+	answer := make([]uint64, 0, len(m))
+	for k := range m {
+		answer = append(answer, k)
+	}
+	sort.Slice(answer, func(i, j int) bool { return answer[i] < answer[j] })
+	return answer
+}
+
+func TestBitmap64Basic(t *testing.T) {
+	rb := NewBitmap64()
+	assert.True(t, rb.IsEmpty())
+
+	values := []uint64{0, 1, 1 << 32, 1<<32 + 5, 1 << 40, ^uint64(0)}
+	for _, v := range values {
+		assert.True(t, rb.CheckedAdd(v))
+		assert.False(t, rb.CheckedAdd(v))
+	}
+	assert.EqualValues(t, len(values), rb.GetCardinality())
+	assert.Equal(t, values, rb.ToArray())
+	assert.EqualValues(t, 0, rb.Minimum())
+	assert.Equal(t, ^uint64(0), rb.Maximum())
+	assert.Equal(t, "{0,1,4294967296,4294967301,1099511627776,18446744073709551615}", rb.String())
+
+	for _, v := range values {
+		assert.True(t, rb.Contains(v))
+	}
+	assert.False(t, rb.Contains(2))
+	assert.False(t, rb.Contains(1<<32+1))
+
+	assert.True(t, rb.CheckedRemove(1<<40))
+	assert.False(t, rb.CheckedRemove(1<<40))
+	assert.False(t, rb.Contains(1<<40))
+	assert.Equal(t, 3, len(rb.keys))
+
+	rb.Clear()
+	assert.True(t, rb.IsEmpty())
+}
+
+func TestBitmap64Ranges(t *testing.T) {
+	rb := NewBitmap64()
+	rb.AddRange(1<<32-10, 1<<32+10)
+	assert.EqualValues(t, 20, rb.GetCardinality())
+	assert.Equal(t, 2, len(rb.keys))
+	assert.True(t, rb.Contains(1<<32-1))
+	assert.True(t, rb.Contains(1<<32))
+	assert.False(t, rb.Contains(1<<32+10))
+
+	rb.RemoveRange(1<<32-5, 1<<32+10)
+	assert.EqualValues(t, 5, rb.GetCardinality())
+	assert.Equal(t, 1, len(rb.keys))
+	assert.Equal(t, uint64(1<<32-6), rb.Maximum())
+
+	rb.AddRange(3<<32, 5<<32)
+	assert.Equal(t, uint64(5+2<<32), rb.GetCardinality())
+	rb.RemoveRange(0, ^uint64(0))
+	assert.True(t, rb.IsEmpty())
+}
+
+func TestBitmap64RankSelect(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	rb, m := randomBitmap64(r, 10000)
+	expected := sortedKeys64(m)
+
+	for i, v := range expected {
+		assert.EqualValues(t, i+1, rb.Rank(v))
+		s, err := rb.Select(uint64(i))
+		require.NoError(t, err)
+		assert.Equal(t, v, s)
+	}
+	assert.EqualValues(t, len(expected), rb.Rank(^uint64(0)))
+	_, err := rb.Select(uint64(len(expected)))
+	assert.Error(t, err)
+}
+
+func TestBitmap64Iterators(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	rb, m := randomBitmap64(r, 5000)
+	expected := sortedKeys64(m)
+
+	var got []uint64
+	for it := rb.Iterator(); it.HasNext(); {
+		got = append(got, it.Next())
+	}
+	assert.Equal(t, expected, got)
+
+	got = got[:0]
+	for it := rb.ReverseIterator(); it.HasNext(); {
+		got = append(got, it.Next())
+	}
+	for i, j := 0, len(got)-1; i < j; i, j = i+1, j-1 {
+		got[i], got[j] = got[j], got[i]
+	}
+	assert.Equal(t, expected, got)
+
+	it := rb.Iterator()
+	target := expected[len(expected)/2] + 1
+	it.AdvanceIfNeeded(target)
+	idx := sort.Search(len(expected), func(i int) bool { return expected[i] >= target })
+	assert.Equal(t, expected[idx], it.PeekNext())
+	assert.Equal(t, expected[idx], it.Next())
+
+	it.AdvanceIfNeeded(^uint64(0))
+	assert.False(t, it.HasNext())
+}
+
+func TestBitmap64SetOperations(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for trial := 0; trial < 10; trial++ {
+		a, ma := randomBitmap64(r, 3000)
+		b, mb := randomBitmap64(r, 3000)
+
+		and, or, xor, andnot := map[uint64]bool{}, map[uint64]bool{}, map[uint64]bool{}, map[uint64]bool{}
+		for k := range ma {
+			or[k] = true
+			if mb[k] {
+				and[k] = true
+			} else {
+				xor[k] = true
+				andnot[k] = true
+			}
+		}
+		for k := range mb {
+			or[k] = true
+			if !ma[k] {
+				xor[k] = true
+			}
+		}
+
+		assert.Equal(t, sortedKeys64(and), And64(a, b).ToArray())
+		assert.Equal(t, sortedKeys64(or), Or64(a, b).ToArray())
+		assert.Equal(t, sortedKeys64(xor), Xor64(a, b).ToArray())
+		assert.Equal(t, sortedKeys64(andnot), AndNot64(a, b).ToArray())
+		assert.EqualValues(t, len(and), a.AndCardinality(b))
+		assert.Equal(t, len(and) > 0, a.Intersects(b))
+
+		// the operands must be left untouched
+		assert.Equal(t, sortedKeys64(ma), a.ToArray())
+		assert.Equal(t, sortedKeys64(mb), b.ToArray())
+
+		c := a.Clone()
+		c.And(b)
+		assert.Equal(t, sortedKeys64(and), c.ToArray())
+		c = a.Clone()
+		c.Or(b)
+		assert.Equal(t, sortedKeys64(or), c.ToArray())
+		c = a.Clone()
+		c.Xor(b)
+		assert.Equal(t, sortedKeys64(xor), c.ToArray())
+		c = a.Clone()
+		c.AndNot(b)
+		assert.Equal(t, sortedKeys64(andnot), c.ToArray())
+	}
+
+	a := Bitmap64Of(1, 1<<32)
+	b := Bitmap64Of(1, 1<<32)
+	a.Xor(b)
+	assert.True(t, a.IsEmpty())
+	assert.Equal(t, 0, len(a.keys))
+}
+
+func TestBitmap64Serialization(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	rb, _ := randomBitmap64(r, 20000)
+	rb.AddRange(7<<32, 7<<32+100000)
+	rb.RunOptimize()
+
+	buf := &bytes.Buffer{}
+	n, err := rb.WriteTo(buf)
+	require.NoError(t, err)
+	assert.EqualValues(t, buf.Len(), n)
+	assert.EqualValues(t, buf.Len(), rb.GetSerializedSizeInBytes())
+
+	data := buf.Bytes()
+
+	fromStream := NewBitmap64()
+	n, err = fromStream.ReadFrom(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.EqualValues(t, len(data), n)
+	assert.True(t, rb.Equals(fromStream))
+
+	fromBuffer := NewBitmap64()
+	n, err = fromBuffer.FromBuffer(data)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(data), n)
+	assert.True(t, rb.Equals(fromBuffer))
+
+	bin, err := rb.MarshalBinary()
+	require.NoError(t, err)
+	fromBinary := NewBitmap64()
+	require.NoError(t, fromBinary.UnmarshalBinary(bin))
+	assert.True(t, rb.Equals(fromBinary))
+}
+
+func TestBitmap64SerializationLayout(t *testing.T) {
+	rb := Bitmap64Of(1, 2, 3<<32|7)
+
+	// count, then (key, 32-bit portable bitmap) pairs
+	expected := &bytes.Buffer{}
+	binary.Write(expected, binary.LittleEndian, uint64(2))
+	binary.Write(expected, binary.LittleEndian, uint32(0))
+	BitmapOf(1, 2).WriteTo(expected)
+	binary.Write(expected, binary.LittleEndian, uint32(3))
+	BitmapOf(7).WriteTo(expected)
+
+	data, err := rb.ToBytes()
+	require.NoError(t, err)
+	assert.Equal(t, expected.Bytes(), data)
+}
+
+func TestBitmap64SerializationMalformed(t *testing.T) {
+	rb := NewBitmap64()
+	_, err := rb.ReadFrom(bytes.NewReader([]byte{1, 0, 0}))
+	assert.Error(t, err)
+
+	// keys out of order
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, uint64(2))
+	binary.Write(buf, binary.LittleEndian, uint32(5))
+	BitmapOf(1).WriteTo(buf)
+	binary.Write(buf, binary.LittleEndian, uint32(4))
+	BitmapOf(1).WriteTo(buf)
+	_, err = rb.ReadFrom(bytes.NewReader(buf.Bytes()))
+	assert.Error(t, err)
+	_, err = rb.FromBuffer(buf.Bytes())
+	assert.Error(t, err)
+
+	// truncated
+	_, err = rb.FromBuffer(buf.Bytes()[:14])
+	assert.Error(t, err)
+}
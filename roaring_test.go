@@ -6,6 +6,7 @@ import (
 	"math"
 	"math/rand"
 	"strconv"
+	"sync"
 	"testing"
 	"unsafe"
 
@@ -2308,3 +2309,387 @@ func TestBitmapFlipMaxRangeEnd(t *testing.T) {
 
 	assert.EqualValues(t, MaxRange, bm.GetCardinality())
 }
+
+func TestBitmapRangeQueries(t *testing.T) {
+	rb := NewBitmap()
+	r := rand.New(rand.NewSource(5))
+	for i := 0; i < 20000; i++ {
+		rb.Add(uint32(r.Intn(1 << 18)))
+	}
+	rb.AddRange(1<<18, 1<<19+100)
+	rb.AddRange(MaxUint32-10, MaxRange)
+	runs := rb.Clone()
+	runs.RunOptimize()
+
+	check := func(start, end uint64) {
+		expected := uint64(0)
+		if end > start && start < MaxRange {
+			expected = rb.Rank(uint32(minOfUint64(end, MaxRange)-1)) - rb.Rank(uint32(start)) + boolToUint64(rb.Contains(uint32(start)))
+		}
+		for _, b := range []*Bitmap{rb, runs} {
+			assert.Equal(t, expected, b.RangeCardinality(start, end), "[%d,%d)", start, end)
+			assert.Equal(t, end <= start || (end <= MaxRange && expected == end-start), b.ContainsRange(start, end), "[%d,%d)", start, end)
+			assert.Equal(t, expected > 0, b.IntersectsRange(start, end), "[%d,%d)", start, end)
+		}
+	}
+	for i := 0; i < 2000; i++ {
+		start := uint64(r.Intn(1 << 20))
+		check(start, start+uint64(r.Intn(1<<17)))
+	}
+	check(0, MaxRange)
+	check(0, MaxRange+10)
+	check(1<<18, 1<<19+100)
+	check(1<<18-1, 1<<19+100)
+	check(1<<18, 1<<19+101)
+	check(1<<18+5, 1<<19)
+	check(MaxUint32-10, MaxRange)
+	check(MaxUint32-11, MaxRange)
+	check(MaxRange, MaxRange+5)
+	check(100, 100)
+	check(100, 50)
+}
+
+func minOfUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func boolToUint64(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestBitmapIterate(t *testing.T) {
+	rb := NewBitmap()
+	r := rand.New(rand.NewSource(6))
+	for i := 0; i < 5000; i++ {
+		rb.Add(uint32(r.Intn(1 << 20)))
+	}
+	rb.AddRange(3<<16, 3<<16+50000)
+	rb.AddRange(10<<16+60000, 11<<16+100)
+	rb.Add(MaxUint32)
+	rb.Add(0)
+	for _, b := range []*Bitmap{rb, func() *Bitmap { c := rb.Clone(); c.RunOptimize(); return c }()} {
+		expected := b.ToArray()
+
+		var got []uint32
+		b.Iterate(func(x uint32) bool {
+			got = append(got, x)
+			return true
+		})
+		assert.Equal(t, expected, got)
+
+		got = got[:0]
+		b.IterateReverse(func(x uint32) bool {
+			got = append(got, x)
+			return true
+		})
+		for i, j := 0, len(got)-1; i < j; i, j = i+1, j-1 {
+			got[i], got[j] = got[j], got[i]
+		}
+		assert.Equal(t, expected, got)
+
+		// early exit
+		for _, stop := range []int{1, 10, 5000, 30000} {
+			n := 0
+			b.Iterate(func(x uint32) bool {
+				assert.Equal(t, expected[n], x)
+				n++
+				return n < stop
+			})
+			assert.Equal(t, stop, n)
+			n = 0
+			b.IterateReverse(func(x uint32) bool {
+				assert.Equal(t, expected[len(expected)-1-n], x)
+				n++
+				return n < stop
+			})
+			assert.Equal(t, stop, n)
+		}
+	}
+
+	NewBitmap().Iterate(func(x uint32) bool {
+		t.Fatal("empty bitmap")
+		return true
+	})
+
+	sum := uint64(0)
+	allocs := testing.AllocsPerRun(10, func() {
+		rb.Iterate(func(x uint32) bool {
+			sum += uint64(x)
+			return true
+		})
+	})
+	assert.EqualValues(t, 0, allocs)
+}
+
+func TestBitmapSimilarity(t *testing.T) {
+	r := rand.New(rand.NewSource(13))
+	var bitmaps []*Bitmap
+	for i := 0; i < 6; i++ {
+		rb := NewBitmap()
+		for j := 0; j < 20000*i; j++ {
+			rb.Add(uint32(r.Intn(8 << 16)))
+		}
+		rb.AddRange(uint64(r.Intn(8<<16)), uint64(r.Intn(8<<16)))
+		if i%2 == 1 {
+			rb.RunOptimize()
+		}
+		bitmaps = append(bitmaps, rb)
+	}
+	for _, a := range bitmaps {
+		for _, b := range bitmaps {
+			assert.Equal(t, AndNot(a, b).GetCardinality(), a.AndNotCardinality(b))
+			assert.Equal(t, Xor(a, b).GetCardinality(), a.XorCardinality(b))
+			inter := float64(And(a, b).GetCardinality())
+			if union := Or(a, b).GetCardinality(); union > 0 {
+				assert.InDelta(t, inter/float64(union), Jaccard(a, b), 1e-12)
+			}
+			if m := minOfUint64(a.GetCardinality(), b.GetCardinality()); m > 0 {
+				assert.InDelta(t, inter/float64(m), Overlap(a, b), 1e-12)
+			}
+		}
+	}
+
+	a := BitmapOf(1, 2, 3, 4)
+	b := BitmapOf(3, 4, 5, 1<<20)
+	assert.EqualValues(t, 2, a.AndNotCardinality(b))
+	assert.EqualValues(t, 4, a.XorCardinality(b))
+	assert.Equal(t, 1/3.0, Jaccard(a, b))
+	assert.Equal(t, 0.5, Overlap(a, b))
+	assert.Equal(t, 1.0, Jaccard(a, a))
+	assert.Equal(t, 0.0, Jaccard(NewBitmap(), NewBitmap()))
+	assert.Equal(t, 0.0, Overlap(a, NewBitmap()))
+}
+
+func TestBitmapRankIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(14))
+	rb := NewBitmap()
+	ref := NewBitmap()
+	rb.SetRankIndex(true)
+	assert.True(t, rb.GetRankIndex())
+	assert.False(t, ref.GetRankIndex())
+
+	check := func(step string) {
+		assert.Equal(t, ref.GetCardinality(), rb.GetCardinality(), step)
+		for i := 0; i < 200; i++ {
+			x := uint32(r.Intn(20 << 16))
+			assert.Equal(t, ref.Rank(x), rb.Rank(x), step)
+		}
+		assert.Equal(t, ref.Rank(MaxUint32), rb.Rank(MaxUint32), step)
+		card := ref.GetCardinality()
+		for i := 0; i < 200 && card > 0; i++ {
+			x := uint32(r.Int63n(int64(card)))
+			expected, err := ref.Select(x)
+			assert.NoError(t, err)
+			got, err := rb.Select(x)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, got, step)
+		}
+		_, err := rb.Select(uint32(card))
+		assert.Error(t, err, step)
+	}
+	check("empty")
+
+	apply := func(step string, f func(b *Bitmap)) {
+		f(rb)
+		f(ref)
+		check(step)
+	}
+	values := make([]uint32, 10000)
+	for i := range values {
+		values[i] = uint32(r.Intn(20 << 16))
+	}
+	apply("add", func(b *Bitmap) {
+		for _, x := range values {
+			b.Add(x)
+		}
+	})
+	apply("add range", func(b *Bitmap) { b.AddRange(3<<16+5, 6<<16) })
+	apply("remove", func(b *Bitmap) { b.Remove(3<<16 + 7) })
+	apply("remove range", func(b *Bitmap) { b.RemoveRange(5<<16, 5<<16+100) })
+	apply("flip", func(b *Bitmap) { b.Flip(100, 2<<16) })
+	other := NewBitmap()
+	for i := 0; i < 10000; i++ {
+		other.Add(uint32(r.Intn(24 << 16)))
+	}
+	apply("or", func(b *Bitmap) { b.Or(other) })
+	apply("xor", func(b *Bitmap) { b.Xor(other) })
+	apply("and not", func(b *Bitmap) { b.AndNot(BitmapOf(1, 2, 3, 4<<16)) })
+	apply("and", func(b *Bitmap) { b.And(Flip(other, 0, 10<<16)) })
+	apply("run optimize", func(b *Bitmap) { b.RunOptimize() })
+
+	c := rb.Clone()
+	assert.True(t, c.GetRankIndex())
+	c.Add(MaxUint32)
+	check("clone")
+	assert.Equal(t, rb.GetCardinality()+1, c.GetCardinality())
+
+	buf, err := other.ToBytes()
+	assert.NoError(t, err)
+	apply("from buffer", func(b *Bitmap) {
+		_, err := b.FromBuffer(buf)
+		assert.NoError(t, err)
+	})
+	apply("add to buffer", func(b *Bitmap) { b.AddMany([]uint32{1, 2, 3, 1 << 20, 1<<20 + 1}) })
+	apply("clear", func(b *Bitmap) { b.Clear() })
+
+	rb.SetRankIndex(false)
+	assert.False(t, rb.GetRankIndex())
+}
+
+func TestConcurrentRankIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(13))
+	rb := NewBitmap()
+	rb.SetRankIndex(true)
+	ref := NewBitmap()
+	for round := 0; round < 5; round++ {
+		// the mutation invalidates the index, the readers race to rebuild it
+		for i := 0; i < 5000; i++ {
+			x := uint32(r.Intn(30 << 16))
+			rb.Add(x)
+			ref.Add(x)
+		}
+		values := ref.ToArray()
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(seed int64) {
+				defer wg.Done()
+				r := rand.New(rand.NewSource(seed))
+				assert.EqualValues(t, len(values), rb.GetCardinality())
+				for i := 0; i < 200; i++ {
+					j := r.Intn(len(values))
+					assert.EqualValues(t, j+1, rb.Rank(values[j]))
+					x, err := rb.Select(uint32(j))
+					assert.NoError(t, err)
+					assert.Equal(t, values[j], x)
+				}
+			}(int64(round*8 + g))
+		}
+		wg.Wait()
+	}
+}
+
+func TestBitmapRankIterator(t *testing.T) {
+	r := rand.New(rand.NewSource(15))
+	rb := NewBitmap()
+	for i := 0; i < 30000; i++ {
+		rb.Add(uint32(r.Intn(12 << 16)))
+	}
+	for i := 0; i < 20000; i++ {
+		rb.Add(4<<16 | uint32(r.Intn(1<<16)))
+	}
+	rb.AddRange(7<<16+10, 9<<16+20)
+	rb.RunOptimize()
+	values := rb.ToArray()
+	card := uint64(len(values))
+
+	for _, indexed := range []bool{false, true} {
+		rb.SetRankIndex(indexed)
+		it := rb.RankIterator()
+		for i := 0; i < 100; i++ {
+			assert.Equal(t, uint64(i), it.Rank())
+			assert.Equal(t, values[i], it.Next())
+		}
+		for i := 0; i < 300; i++ {
+			n := uint64(r.Int63n(int64(card)))
+			it.SeekToRank(n)
+			assert.Equal(t, n, it.Rank())
+			for j := n; j < n+10 && j < card; j++ {
+				assert.True(t, it.HasNext())
+				assert.Equal(t, j, it.Rank())
+				assert.Equal(t, values[j], it.Next())
+			}
+		}
+		it.SeekToRank(card - 1)
+		assert.Equal(t, values[card-1], it.Next())
+		assert.False(t, it.HasNext())
+		assert.Equal(t, card, it.Rank())
+		it.SeekToRank(card + 5)
+		assert.False(t, it.HasNext())
+		assert.Equal(t, card, it.Rank())
+
+		for i := 0; i < 300; i++ {
+			x := uint32(1 + r.Intn(12<<16))
+			it.SeekToRank(uint64(r.Int63n(int64(rb.Rank(x-1) + 1))))
+			it.AdvanceIfNeeded(x)
+			assert.Equal(t, rb.Rank(x-1), it.Rank())
+			if it.HasNext() {
+				assert.Equal(t, values[it.Rank()], it.PeekNext())
+			}
+		}
+		it.SeekToRank(0)
+		it.AdvanceIfNeeded(MaxUint32)
+		assert.Equal(t, card, it.Rank())
+
+		for _, fromTo := range [][2]uint64{{0, 10}, {9990, 10050}, {card - 5, card + 5}, {100, 50}, {card, card + 1}, {0, card}} {
+			from, to := fromTo[0], fromTo[1]
+			var expected []uint32
+			if from < to && from < card {
+				expected = values[from:minOfUint64(to, card)]
+			}
+			assert.Equal(t, expected, rb.SliceByRank(from, to))
+		}
+	}
+}
+
+func TestBitmapAddManyUnsorted(t *testing.T) {
+	r := rand.New(rand.NewSource(17))
+	newBase := func() *Bitmap {
+		rb := NewBitmap()
+		for i := 0; i < 20000; i++ {
+			rb.Add(uint32(r.Intn(30 << 16)))
+		}
+		rb.AddRange(10<<16, 12<<16+5)
+		rb.RunOptimize()
+		return rb
+	}
+	base := newBase()
+	buf, err := base.ToBytes()
+	assert.NoError(t, err)
+	frozen := NewBitmap()
+	_, err = frozen.FromBuffer(buf)
+	assert.NoError(t, err)
+
+	for _, rb := range []*Bitmap{NewBitmap(), base, frozen} {
+		for _, n := range []int{0, 1, 100, 5000, 200000} {
+			dat := make([]uint32, n)
+			for i := range dat {
+				switch i % 3 {
+				case 0:
+					dat[i] = uint32(r.Intn(40 << 16))
+				case 1:
+					dat[i] = 5<<16 | uint32(r.Intn(1<<16))
+				default:
+					dat[i] = r.Uint32()
+				}
+			}
+			if n > 10 {
+				dat[n-1] = dat[0] // duplicates
+				dat[1], dat[2] = MaxUint32, 0
+			}
+			orig := make([]uint32, n)
+			copy(orig, dat)
+
+			expected := rb.Clone()
+			expected.AddMany(dat)
+			seq := rb.Clone()
+			seq.AddManyUnsorted(dat)
+			assert.True(t, expected.Equals(seq), "n=%d", n)
+			assert.Equal(t, expected.GetCardinality(), seq.GetCardinality())
+			assert.NoError(t, seq.highlowcontainer.validate())
+			for _, p := range []int{0, 1, 3} {
+				par := rb.Clone()
+				par.ParAddManyUnsorted(p, dat)
+				assert.True(t, expected.Equals(par), "n=%d p=%d", n, p)
+			}
+			assert.Equal(t, orig, dat)
+		}
+	}
+	assert.True(t, frozen.Equals(base))
+}
@@ -7,6 +7,7 @@ import (
 	snappy "github.com/glycerine/go-unsnap-stream"
 	"github.com/tinylib/msgp/msgp"
 	"io"
+	"sync"
 )
 
 //go:generate msgp -unexported
@@ -41,6 +42,10 @@ type container interface {
 	getReverseIterator() shortIterable
 	getManyIterator() manyIterable
 	contains(i uint16) bool
+	// the range methods below take [start,end) with end at most 1<<16
+	getCardinalityInRange(start, end uint) int
+	containsRange(start, end uint) bool
+	intersectsRange(start, end uint) bool
 	maximum() uint16
 	minimum() uint16
 
@@ -68,6 +73,10 @@ type container interface {
 	toEfficientContainer() container
 	String() string
 	containerType() contype
+
+	// validate checks the invariants of a container read from
+	// untrusted input
+	validate() error
 }
 
 type contype uint8
@@ -105,6 +114,10 @@ type roaringArray struct {
 	// conserz is used at serialization time
 	// to serialize containers. Otherwise empty.
 	conserz []containerSerz
+
+	// rank caches the cumulative cardinalities of the containers,
+	// nil unless enabled with Bitmap.SetRankIndex
+	rank *rankIndex `msg:"-"`
 }
 
 // containerSerz facilitates serializing container (tricky to
@@ -115,6 +128,51 @@ type containerSerz struct {
 	r msgp.Raw `msg:"r"` // Raw msgpack of the actual container type
 }
 
+// rankIndex holds the prefix sums of the container cardinalities: sums[i]
+// is the cardinality of the containers 0 to i. A mutation replaces the
+// snapshot once it has been built, and each snapshot is built at most once,
+// on first use, so that concurrent readers can share it safely.
+type rankIndex struct {
+	snapshot *rankSnapshot
+}
+
+type rankSnapshot struct {
+	once  sync.Once
+	built bool
+	sums  []uint64
+}
+
+func newRankIndex() *rankIndex {
+	return &rankIndex{snapshot: &rankSnapshot{}}
+}
+
+func (ra *roaringArray) invalidateRankIndex() {
+	// mutations do not run concurrently with readers, so built can be read
+	// without synchronization
+	if ra.rank != nil && ra.rank.snapshot.built {
+		ra.rank.snapshot = &rankSnapshot{}
+	}
+}
+
+// rankSums returns the prefix sums of the container cardinalities, nil if
+// the rank index is not enabled
+func (ra *roaringArray) rankSums() []uint64 {
+	if ra.rank == nil {
+		return nil
+	}
+	s := ra.rank.snapshot
+	s.once.Do(func() {
+		s.sums = make([]uint64, len(ra.containers))
+		total := uint64(0)
+		for i, c := range ra.containers {
+			total += uint64(c.getCardinality())
+			s.sums[i] = total
+		}
+		s.built = true
+	})
+	return s.sums
+}
+
 func newRoaringArray() *roaringArray {
 	return &roaringArray{}
 }
@@ -132,6 +190,7 @@ func (ra *roaringArray) runOptimize() {
 }
 
 func (ra *roaringArray) appendContainer(key uint16, value container, mustCopyOnWrite bool) {
+	ra.invalidateRankIndex()
 	ra.keys = append(ra.keys, key)
 	ra.containers = append(ra.containers, value)
 	ra.needCopyOnWrite = append(ra.needCopyOnWrite, mustCopyOnWrite)
@@ -232,6 +291,7 @@ func (ra *roaringArray) removeIndexRange(begin, end int) {
 }
 
 func (ra *roaringArray) resize(newsize int) {
+	ra.invalidateRankIndex()
 	for k := newsize; k < len(ra.containers); k++ {
 		ra.containers[k] = nil
 	}
@@ -251,6 +311,9 @@ func (ra *roaringArray) clone() *roaringArray {
 
 	sa := roaringArray{}
 	sa.copyOnWrite = ra.copyOnWrite
+	if ra.rank != nil {
+		sa.rank = newRankIndex()
+	}
 
 	// this is where copyOnWrite is used.
 	if ra.copyOnWrite {
@@ -323,10 +386,14 @@ func (ra *roaringArray) getFastContainerAtIndex(i int, needsWriteable bool) cont
 			c = ra.containers[i].clone()
 		}
 	}
+	if needsWriteable {
+		ra.invalidateRankIndex()
+	}
 	return c
 }
 
 func (ra *roaringArray) getWritableContainerAtIndex(i int) container {
+	ra.invalidateRankIndex()
 	if ra.needCopyOnWrite[i] {
 		ra.containers[i] = ra.containers[i].clone()
 		ra.needCopyOnWrite[i] = false
@@ -343,11 +410,22 @@ func (ra *roaringArray) getIndex(x uint16) int {
 	return ra.binarySearch(0, int64(size), x)
 }
 
+// getIndexAtOrAfter returns the index of the first key that is at least
+// x, ra.size() if there is none
+func (ra *roaringArray) getIndexAtOrAfter(x uint16) int {
+	i := ra.binarySearch(0, int64(ra.size()), x)
+	if i < 0 {
+		return -i - 1
+	}
+	return i
+}
+
 func (ra *roaringArray) getKeyAtIndex(i int) uint16 {
 	return ra.keys[i]
 }
 
 func (ra *roaringArray) insertNewKeyValueAt(i int, key uint16, value container) {
+	ra.invalidateRankIndex()
 	ra.keys = append(ra.keys, 0)
 	ra.containers = append(ra.containers, nil)
 
@@ -381,10 +459,12 @@ func (ra *roaringArray) removeAtIndex(i int) {
 }
 
 func (ra *roaringArray) setContainerAtIndex(i int, c container) {
+	ra.invalidateRankIndex()
 	ra.containers[i] = c
 }
 
 func (ra *roaringArray) replaceKeyAndContainerAtIndex(i int, key uint16, c container, mustCopyOnWrite bool) {
+	ra.invalidateRankIndex()
 	ra.keys[i] = key
 	ra.containers[i] = c
 	ra.needCopyOnWrite[i] = mustCopyOnWrite
@@ -559,129 +639,232 @@ func (ra *roaringArray) toBytes() ([]byte, error) {
 }
 
 func (ra *roaringArray) readFrom(stream byteInput) (int64, error) {
-	cookie, err := stream.readUInt32()
+	ra.invalidateRankIndex()
+	h, err := readSerializedHeader(stream)
 
 	if err != nil {
-		return stream.getReadBytes(), fmt.Errorf("error in roaringArray.readFrom: could not read initial cookie: %s", err)
+		return stream.getReadBytes(), err
 	}
 
-	var size uint32
-	var isRunBitmap []byte
+	size := h.size
 
-	if cookie&0x0000FFFF == serialCookie {
-		size = uint32(uint16(cookie>>16) + 1)
-		// create is-run-container bitmap
-		isRunBitmapSize := (int(size) + 7) / 8
-		isRunBitmap, err = stream.next(isRunBitmapSize)
+	// Allocate slices upfront as number of containers is known
+	if cap(ra.containers) >= size {
+		ra.containers = ra.containers[:size]
+	} else {
+		ra.containers = make([]container, size)
+	}
+
+	if cap(ra.keys) >= size {
+		ra.keys = ra.keys[:size]
+	} else {
+		ra.keys = make([]uint16, size)
+	}
+
+	if cap(ra.needCopyOnWrite) >= size {
+		ra.needCopyOnWrite = ra.needCopyOnWrite[:size]
+	} else {
+		ra.needCopyOnWrite = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		ra.keys[i] = h.key(i)
+		ra.needCopyOnWrite[i] = true
+
+		c, err := readContainer(stream, h.cardinality(i), h.isRunContainer(i))
+
+		if err != nil {
+			return stream.getReadBytes(), err
+		}
+
+		ra.containers[i] = c
+	}
+
+	return stream.getReadBytes(), nil
+}
+
+// readContainer reads the next container of a serialized bitmap, given the
+// cardinality found in the header
+func readContainer(stream byteInput, card int, isRun bool) (container, error) {
+	if isRun {
+		// run container
+		nr, err := stream.readUInt16()
 
 		if err != nil {
-			return stream.getReadBytes(), fmt.Errorf("malformed bitmap, failed to read is-run bitmap, got: %s", err)
+			return nil, fmt.Errorf("failed to read runtime container size: %s", err)
 		}
-	} else if cookie == serialCookieNoRunContainer {
-		size, err = stream.readUInt32()
+
+		buf, err := stream.next(int(nr) * 4)
 
 		if err != nil {
-			return stream.getReadBytes(), fmt.Errorf("malformed bitmap, failed to read a bitmap size: %s", err)
+			return nil, fmt.Errorf("failed to read runtime container content: %s", err)
 		}
-	} else {
-		return stream.getReadBytes(), fmt.Errorf("error in roaringArray.readFrom: did not find expected serialCookie in header")
-	}
 
-	if size > (1 << 16) {
-		return stream.getReadBytes(), fmt.Errorf("it is logically impossible to have more than (1<<16) containers")
+		return &runContainer16{
+			iv:   byteSliceAsInterval16Slice(buf),
+			card: int64(card),
+		}, nil
+	} else if card > arrayDefaultMaxSize {
+		// bitmap container
+		buf, err := stream.next(arrayDefaultMaxSize * 2)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bitmap container: %s", err)
+		}
+
+		return &bitmapContainer{
+			cardinality: card,
+			bitmap:      byteSliceAsUint64Slice(buf),
+		}, nil
 	}
 
-	// descriptive header
-	buf, err := stream.next(2 * 2 * int(size))
+	// array container
+	buf, err := stream.next(card * 2)
 
 	if err != nil {
-		return stream.getReadBytes(), fmt.Errorf("failed to read descriptive header: %s", err)
+		return nil, fmt.Errorf("failed to read array container: %s", err)
 	}
 
-	keycard := byteSliceAsUint16Slice(buf)
+	return &arrayContainer{
+		byteSliceAsUint16Slice(buf),
+	}, nil
+}
 
-	if isRunBitmap == nil || size >= noOffsetThreshold {
-		if err := stream.skipBytes(int(size) * 4); err != nil {
-			return stream.getReadBytes(), fmt.Errorf("failed to skip bytes: %s", err)
+// skipContainer skips the next container of a serialized bitmap
+func skipContainer(stream byteInput, card int, isRun bool) error {
+	n := card * 2
+	if isRun {
+		nr, err := stream.readUInt16()
+		if err != nil {
+			return fmt.Errorf("failed to read runtime container size: %s", err)
 		}
+		n = int(nr) * 4
+	} else if card > arrayDefaultMaxSize {
+		n = arrayDefaultMaxSize * 2
 	}
+	if err := skipForward(stream, n); err != nil {
+		return fmt.Errorf("failed to skip container: %s", err)
+	}
+	return nil
+}
 
-	// Allocate slices upfront as number of containers is known
-	if cap(ra.containers) >= int(size) {
-		ra.containers = ra.containers[:size]
-	} else {
-		ra.containers = make([]container, size)
+// skipForward skips n bytes, seeking rather than reading when the stream
+// wraps an io.Seeker
+func skipForward(stream byteInput, n int) error {
+	if a, ok := stream.(*byteInputAdapter); ok {
+		if s, ok := a.r.(io.Seeker); ok {
+			if _, err := s.Seek(int64(n), io.SeekCurrent); err != nil {
+				return err
+			}
+			a.readBytes += n
+			return nil
+		}
 	}
+	return stream.skipBytes(n)
+}
 
-	if cap(ra.keys) >= int(size) {
-		ra.keys = ra.keys[:size]
-	} else {
-		ra.keys = make([]uint16, size)
+// readRangeFrom is like readFrom but only keeps the values from first to
+// last (included): the containers with smaller keys are skipped, jumping
+// straight to the first needed one when the offset header is present, the
+// boundary containers are trimmed, and reading stops after the last needed
+// container.
+func (ra *roaringArray) readRangeFrom(stream byteInput, first, last uint32) (int64, error) {
+	ra.resize(0)
+	h, err := readSerializedHeader(stream)
+
+	if err != nil {
+		return stream.getReadBytes(), err
 	}
 
-	if cap(ra.needCopyOnWrite) >= int(size) {
-		ra.needCopyOnWrite = ra.needCopyOnWrite[:size]
-	} else {
-		ra.needCopyOnWrite = make([]bool, size)
+	start, end := h.keyRange(first, last)
+	if start == end {
+		return stream.getReadBytes(), nil
 	}
 
-	for i := uint32(0); i < size; i++ {
-		key := keycard[2*i]
-		card := int(keycard[2*i+1]) + 1
-		ra.keys[i] = key
-		ra.needCopyOnWrite[i] = true
+	if h.offsets != nil {
+		target := int64(h.offset(start))
+		if target < stream.getReadBytes() {
+			return stream.getReadBytes(), fmt.Errorf("malformed bitmap, container %d starts at offset %d within the headers", start, target)
+		}
+		if err := skipForward(stream, int(target-stream.getReadBytes())); err != nil {
+			return stream.getReadBytes(), fmt.Errorf("failed to skip bytes: %s", err)
+		}
+	} else {
+		for i := 0; i < start; i++ {
+			if err := skipContainer(stream, h.cardinality(i), h.isRunContainer(i)); err != nil {
+				return stream.getReadBytes(), err
+			}
+		}
+	}
 
-		if isRunBitmap != nil && isRunBitmap[i/8]&(1<<(i%8)) != 0 {
-			// run container
-			nr, err := stream.readUInt16()
+	for i := start; i < end; i++ {
+		c, err := readContainer(stream, h.cardinality(i), h.isRunContainer(i))
 
-			if err != nil {
-				return 0, fmt.Errorf("failed to read runtime container size: %s", err)
-			}
+		if err != nil {
+			return stream.getReadBytes(), err
+		}
 
-			buf, err := stream.next(int(nr) * 4)
+		ra.appendTrimmed(h.key(i), c, first, last)
+	}
 
-			if err != nil {
-				return stream.getReadBytes(), fmt.Errorf("failed to read runtime container content: %s", err)
-			}
+	return stream.getReadBytes(), nil
+}
 
-			nb := runContainer16{
-				iv:   byteSliceAsInterval16Slice(buf),
-				card: int64(card),
-			}
+// fromBufferRange is like readRangeFrom, reading from buf as FromBuffer
+// does
+func (ra *roaringArray) fromBufferRange(buf []byte, first, last uint32) (int64, error) {
+	ra.resize(0)
+	h, err := parseSerializedHeader(buf)
 
-			ra.containers[i] = &nb
-		} else if card > arrayDefaultMaxSize {
-			// bitmap container
-			buf, err := stream.next(arrayDefaultMaxSize * 2)
+	if err != nil {
+		return 0, err
+	}
 
-			if err != nil {
-				return stream.getReadBytes(), fmt.Errorf("failed to read bitmap container: %s", err)
-			}
+	p := int64(h.start)
+	start, end := h.keyRange(first, last)
+	for i := start; i < end; i++ {
+		c, err := h.container(i)
 
-			nb := bitmapContainer{
-				cardinality: card,
-				bitmap:      byteSliceAsUint64Slice(buf),
-			}
+		if err != nil {
+			return p, err
+		}
 
-			ra.containers[i] = &nb
-		} else {
-			// array container
-			buf, err := stream.next(card * 2)
+		n, _ := h.containerSize(i)
+		p = int64(h.offset(i) + n)
+		ra.appendTrimmed(h.key(i), c, first, last)
+	}
 
-			if err != nil {
-				return stream.getReadBytes(), fmt.Errorf("failed to read array container: %s", err)
-			}
+	return p, nil
+}
 
-			nb := arrayContainer{
-				byteSliceAsUint16Slice(buf),
-			}
+// appendTrimmed appends the values of c, a container read from a
+// serialized bitmap, from first to last (included). It is shared if it is
+// kept whole, otherwise it is replaced by a trimmed copy, or dropped if
+// nothing is left.
+func (ra *roaringArray) appendTrimmed(key uint16, c container, first, last uint32) {
+	s, e := containerRange(key, first, last)
+	if s == 0 && e == maxCapacity {
+		ra.appendContainer(key, c, true)
+		return
+	}
+	c = c.and(rangeOfOnes(int(s), int(e)-1))
+	if c.getCardinality() > 0 {
+		ra.appendContainer(key, c, false)
+	}
+}
 
-			ra.containers[i] = &nb
+// validate checks that the keys are strictly increasing and that every
+// container is well formed, it is meant for data read from untrusted input
+func (ra *roaringArray) validate() error {
+	for i, c := range ra.containers {
+		if i > 0 && ra.keys[i] <= ra.keys[i-1] {
+			return fmt.Errorf("malformed bitmap, keys not strictly increasing at container %d: %d after %d", i, ra.keys[i], ra.keys[i-1])
+		}
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("malformed bitmap, invalid container %d (key %d): %s", i, ra.keys[i], err)
 		}
 	}
-
-	return stream.getReadBytes(), nil
+	return nil
 }
 
 func (ra *roaringArray) hasRunCompression() bool {
@@ -731,6 +914,7 @@ func (ra *roaringArray) writeToMsgpack(stream io.Writer) error {
 }
 
 func (ra *roaringArray) readFromMsgpack(stream io.Reader) error {
+	ra.invalidateRankIndex()
 	r := snappy.NewReader(stream)
 	err := msgp.Decode(r, ra)
 	if err != nil {
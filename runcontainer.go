@@ -848,6 +848,51 @@ func (rc *runContainer16) contains(key uint16) bool {
 	return in
 }
 
+// firstIntervalEndingAtOrAfter returns the index of the first interval
+// ending at x or later, len(rc.iv) if there is none. Unlike
+// indexOfIntervalAtOrAfter, it does not touch rc and is safe for
+// concurrent readers.
+func (rc *runContainer16) firstIntervalEndingAtOrAfter(x uint) int {
+	return sort.Search(len(rc.iv), func(i int) bool {
+		return uint(rc.iv[i].last()) >= x
+	})
+}
+
+func (rc *runContainer16) getCardinalityInRange(start, end uint) int {
+	if start >= end {
+		return 0
+	}
+	card := 0
+	for i := rc.firstIntervalEndingAtOrAfter(start); i < len(rc.iv) && uint(rc.iv[i].start) < end; i++ {
+		lo := uint(rc.iv[i].start)
+		if lo < start {
+			lo = start
+		}
+		hi := uint(rc.iv[i].last()) + 1
+		if hi > end {
+			hi = end
+		}
+		card += int(hi - lo)
+	}
+	return card
+}
+
+func (rc *runContainer16) containsRange(start, end uint) bool {
+	if start >= end {
+		return true
+	}
+	i := rc.firstIntervalEndingAtOrAfter(start)
+	return i < len(rc.iv) && uint(rc.iv[i].start) <= start && uint(rc.iv[i].last()) >= end-1
+}
+
+func (rc *runContainer16) intersectsRange(start, end uint) bool {
+	if start >= end {
+		return false
+	}
+	i := rc.firstIntervalEndingAtOrAfter(start)
+	return i < len(rc.iv) && uint(rc.iv[i].start) < end
+}
+
 // numIntervals returns the count of intervals in the container.
 func (rc *runContainer16) numIntervals() int {
 	return len(rc.iv)
@@ -1764,6 +1809,26 @@ func (rc *runContainer16) containerType() contype {
 	return run16Contype
 }
 
+func (rc *runContainer16) validate() error {
+	if len(rc.iv) == 0 {
+		return fmt.Errorf("run container with no runs")
+	}
+	var card int64
+	for i, iv := range rc.iv {
+		if int(iv.start)+int(iv.length) > MaxUint16 {
+			return fmt.Errorf("run %d overflows: start %d, length %d", i, iv.start, iv.length)
+		}
+		if i > 0 && int(iv.start) <= int(rc.iv[i-1].last())+1 {
+			return fmt.Errorf("run %d starting at %d overlaps or touches the previous run ending at %d", i, iv.start, rc.iv[i-1].last())
+		}
+		card += iv.runlen()
+	}
+	if card != rc.card {
+		return fmt.Errorf("run container cardinality mismatch: header says %d, payload has %d", rc.card, card)
+	}
+	return nil
+}
+
 func (rc *runContainer16) equals16(srb *runContainer16) bool {
 	// Check if the containers are the same object.
 	if rc == srb {
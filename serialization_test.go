@@ -630,7 +630,168 @@ func TestSerializationCrashers(t *testing.T) {
 		_, err = NewBitmap().ReadFrom(bytes.NewReader(data))
 
 		assert.Error(t, err)
+
+		copy(data, orig)
+		_, err = NewBitmap().FromBufferValidated(data)
+		assert.Error(t, err)
+
+		copy(data, orig)
+		_, err = NewBitmap().ReadFromValidated(bytes.NewReader(data))
+		assert.Error(t, err)
+	}
+}
+
+func TestSerializationValidated(t *testing.T) {
+	for _, fname := range []string{"testdata/bitmapwithruns.bin", "testdata/bitmapwithoutruns.bin"} {
+		data, err := ioutil.ReadFile(fname)
+		assert.NoError(t, err)
+
+		expected := NewBitmap()
+		_, err = expected.ReadFrom(bytes.NewReader(data))
+		assert.NoError(t, err)
+
+		rb := NewBitmap()
+		_, err = rb.ReadFromValidated(bytes.NewReader(data))
+		assert.NoError(t, err)
+		assert.True(t, expected.Equals(rb))
+
+		rb = NewBitmap()
+		_, err = rb.FromBufferValidated(data)
+		assert.NoError(t, err)
+		assert.True(t, expected.Equals(rb))
+	}
+
+	rb := BitmapOf(1, 2, 3, 1000, 1<<20)
+	rb.AddRange(1<<17, 1<<17+100000)
+	rb.RunOptimize()
+	data, err := rb.ToBytes()
+	assert.NoError(t, err)
+	newrb := NewBitmap()
+	_, err = newrb.FromBufferValidated(data)
+	assert.NoError(t, err)
+	assert.True(t, rb.Equals(newrb))
+}
+
+func TestSerializationValidatedRejects(t *testing.T) {
+	expected := map[string]string{
+		"testdata/invalidkeyorder.bin":          "keys not strictly increasing",
+		"testdata/invalidduplicatekey.bin":      "keys not strictly increasing",
+		"testdata/invalidarrayunsorted.bin":     "array values not strictly increasing",
+		"testdata/invalidarrayduplicate.bin":    "array values not strictly increasing",
+		"testdata/invalidrunoverlap.bin":        "overlaps",
+		"testdata/invalidrunoverflow.bin":       "overflows",
+		"testdata/invalidruncardinality.bin":    "cardinality mismatch",
+		"testdata/invalidrunempty.bin":          "no runs",
+		"testdata/invalidbitmapcardinality.bin": "cardinality mismatch",
+	}
+	invalid, err := filepath.Glob("testdata/invalid*")
+	assert.NoError(t, err)
+	assert.Equal(t, len(expected), len(invalid))
+
+	for _, fname := range invalid {
+		data, err := ioutil.ReadFile(fname)
+		assert.NoError(t, err)
+
+		rb := NewBitmap()
+		_, err = rb.ReadFromValidated(bytes.NewReader(data))
+		if assert.Error(t, err, fname) {
+			assert.Contains(t, err.Error(), expected[fname])
+		}
+		assert.True(t, rb.IsEmpty())
+
+		rb = NewBitmap()
+		_, err = rb.FromBufferValidated(data)
+		if assert.Error(t, err, fname) {
+			assert.Contains(t, err.Error(), expected[fname])
+		}
+		assert.True(t, rb.IsEmpty())
+	}
+}
+
+func TestSerializationRange(t *testing.T) {
+	withRuns := NewBitmap()
+	for k := uint32(0); k < 10; k++ {
+		withRuns.AddRange(uint64(k)<<16+100, uint64(k)<<16+30000)
+		withRuns.Add(k<<16 + 40000 + k)
+	}
+	withRuns.AddRange(1<<20, 3<<20)
+	withRuns.RunOptimize()
+	withoutRuns := NewBitmap()
+	for i := uint32(0); i < 1<<22; i += 7 {
+		withoutRuns.Add(i)
+	}
+	withoutRuns.Add(MaxUint32)
+	smallRuns := BitmapOf(1, 2, 1<<16, MaxUint32)
+	smallRuns.AddRange(1<<16+5, 1<<16+20000)
+	smallRuns.RunOptimize()
+
+	ranges := [][2]uint32{
+		{0, MaxUint32}, {0, 0}, {150, 29000}, {70000, 5 << 16},
+		{1 << 20, 3<<20 - 1}, {5 << 20, 6 << 20}, {MaxUint32, MaxUint32},
+		{1 << 16, 1 << 16}, {65535, 131072},
 	}
+	for _, rb := range []*Bitmap{withRuns, withoutRuns, smallRuns} {
+		data, err := rb.ToBytes()
+		assert.NoError(t, err)
+		for _, r := range ranges {
+			expected := rb.Clone()
+			expected.RemoveRange(0, uint64(r[0]))
+			expected.RemoveRange(uint64(r[1])+1, MaxRange)
+
+			fromBuffer := NewBitmap()
+			_, err = fromBuffer.FromBufferRange(data, r[0], r[1])
+			assert.NoError(t, err)
+			assert.True(t, expected.Equals(fromBuffer), "%v", r)
+			assert.NoError(t, fromBuffer.highlowcontainer.validate())
+
+			seeking := NewBitmap()
+			_, err = seeking.ReadRange(bytes.NewReader(data), r[0], r[1])
+			assert.NoError(t, err)
+			assert.True(t, expected.Equals(seeking), "%v", r)
+
+			// countingReader hides the io.Seeker of the bytes.Reader
+			reader := &countingReader{r: bytes.NewReader(data)}
+			reading := NewBitmap()
+			_, err = reading.ReadRange(reader, r[0], r[1])
+			assert.NoError(t, err)
+			assert.True(t, expected.Equals(reading), "%v", r)
+			assert.True(t, reader.n <= int64(len(data)))
+		}
+	}
+
+	// reading stops after the last container in range
+	data, err := withoutRuns.ToBytes()
+	assert.NoError(t, err)
+	reader := &countingReader{r: bytes.NewReader(data)}
+	rb := NewBitmap()
+	p, err := rb.ReadRange(reader, 0, 1<<16-1)
+	assert.NoError(t, err)
+	assert.True(t, reader.n < int64(len(data)/10))
+	assert.Equal(t, reader.n, p)
+	p, err = rb.FromBufferRange(data, 0, 1<<16-1)
+	assert.NoError(t, err)
+	assert.Equal(t, reader.n, p)
+	p, err = rb.FromBufferRange(data, 0, MaxUint32)
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(data), p)
+
+	// trimmed containers do not refer to the buffer
+	rb = NewBitmap()
+	_, err = rb.FromBufferRange(data, 100, 1<<17+10)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, true, false}, rb.highlowcontainer.needCopyOnWrite)
+
+	rb = BitmapOf(1, 2, 3)
+	_, err = rb.FromBufferRange(data, 10, 5)
+	assert.NoError(t, err)
+	assert.True(t, rb.IsEmpty())
+
+	_, err = rb.FromBufferRange(data[:len(data)-1], 0, MaxUint32)
+	assert.Error(t, err)
+	assert.True(t, rb.IsEmpty())
+	_, err = rb.ReadRange(bytes.NewReader(data[:len(data)/2]), 0, MaxUint32)
+	assert.Error(t, err)
+	assert.True(t, rb.IsEmpty())
 }
 
 func TestBitmapFromBufferCOW(t *testing.T) {
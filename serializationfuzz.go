@@ -19,3 +19,42 @@ func FuzzSerializationBuffer(data []byte) int {
 	}
 	return 1
 }
+
+func FuzzSerializationStreamValidated(data []byte) int {
+	newrb := NewBitmap()
+	if _, err := newrb.ReadFromValidated(bytes.NewReader(data)); err != nil {
+		return 0
+	}
+	exerciseValidated(newrb)
+	return 1
+}
+
+func FuzzSerializationBufferValidated(data []byte) int {
+	newrb := NewBitmap()
+	if _, err := newrb.FromBufferValidated(data); err != nil {
+		return 0
+	}
+	exerciseValidated(newrb)
+	return 1
+}
+
+// exerciseValidated runs a few operations that would misbehave on a
+// malformed bitmap, a validated bitmap must go through them
+func exerciseValidated(rb *Bitmap) {
+	other := BitmapOf(1, 1000, 100000)
+	other.AddRange(1<<16, 3<<16)
+	if And(rb, other).GetCardinality() != rb.AndCardinality(other) {
+		panic("inconsistent intersection")
+	}
+	if Or(rb, other).GetCardinality() != rb.OrCardinality(other) {
+		panic("inconsistent union")
+	}
+	if uint64(len(rb.ToArray())) != rb.GetCardinality() {
+		panic("inconsistent cardinality")
+	}
+	clone := rb.Clone()
+	clone.RunOptimize()
+	if !clone.Equals(rb) {
+		panic("inconsistent run optimization")
+	}
+}
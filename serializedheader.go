@@ -0,0 +1,190 @@
+package roaring
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// serializedHeader gives access to the containers of a bitmap serialized
+// in the portable format without decoding all of them: only the headers
+// are read, a container is decoded on request.
+type serializedHeader struct {
+	buf     []byte
+	size    int
+	isRun   []byte   // one bit per container, nil if there is no run container
+	desc    []byte   // key and cardinality minus one of each container
+	offsets []byte   // offset of each container, nil if absent
+	known   []uint32 // offsets computed when the header omits them
+	start   int      // offset of the first container
+}
+
+// parseSerializedHeader reads the headers of the bitmap serialized in buf
+func parseSerializedHeader(buf []byte) (serializedHeader, error) {
+	h, err := readSerializedHeader(&byteBuffer{buf: buf})
+	h.buf = buf
+	if err != nil || h.offsets != nil {
+		return h, err
+	}
+
+	// small bitmaps with run containers omit the offsets, the containers
+	// follow each other
+	h.known = make([]uint32, h.size)
+	pos := h.start
+	for i := range h.known {
+		h.known[i] = uint32(pos)
+		n, err := h.containerSize(i)
+		if err != nil {
+			return h, err
+		}
+		pos += n
+	}
+	return h, nil
+}
+
+// readSerializedHeader reads the headers of a serialized bitmap from
+// stream, which is left at the first container. The offsets of the
+// containers are only known if the header records them: the result has
+// no buffer to find the others.
+func readSerializedHeader(stream byteInput) (serializedHeader, error) {
+	var h serializedHeader
+	cookie, err := stream.readUInt32()
+	if err != nil {
+		return h, fmt.Errorf("malformed bitmap, could not read initial cookie: %s", err)
+	}
+	if cookie&0x0000FFFF == serialCookie {
+		h.size = int(cookie>>16) + 1
+		if h.isRun, err = stream.next((h.size + 7) / 8); err != nil {
+			return h, fmt.Errorf("malformed bitmap, failed to read is-run bitmap: %s", err)
+		}
+	} else if cookie == serialCookieNoRunContainer {
+		size, err := stream.readUInt32()
+		if err != nil {
+			return h, fmt.Errorf("malformed bitmap, failed to read a bitmap size: %s", err)
+		}
+		if size > maxCapacity {
+			return h, fmt.Errorf("it is logically impossible to have more than (1<<16) containers")
+		}
+		h.size = int(size)
+	} else {
+		return h, fmt.Errorf("malformed bitmap, did not find expected serialCookie in header")
+	}
+
+	if h.desc, err = stream.next(4 * h.size); err != nil {
+		return h, fmt.Errorf("malformed bitmap, failed to read descriptive header: %s", err)
+	}
+	if h.isRun == nil || h.size >= noOffsetThreshold {
+		if h.offsets, err = stream.next(4 * h.size); err != nil {
+			return h, fmt.Errorf("malformed bitmap, failed to read offset header: %s", err)
+		}
+	}
+	h.start = int(stream.getReadBytes())
+	return h, nil
+}
+
+func (h *serializedHeader) key(i int) uint16 {
+	return binary.LittleEndian.Uint16(h.desc[4*i:])
+}
+
+func (h *serializedHeader) cardinality(i int) int {
+	return int(binary.LittleEndian.Uint16(h.desc[4*i+2:])) + 1
+}
+
+func (h *serializedHeader) isRunContainer(i int) bool {
+	return h.isRun != nil && h.isRun[i/8]&(1<<uint(i%8)) != 0
+}
+
+func (h *serializedHeader) offset(i int) int {
+	if h.offsets != nil {
+		return int(binary.LittleEndian.Uint32(h.offsets[4*i:]))
+	}
+	return int(h.known[i])
+}
+
+// getIndex returns the index of the container with the given key, or
+// -(insertion point + 1) if there is none
+func (h *serializedHeader) getIndex(key uint16) int {
+	low, high := 0, h.size-1
+	for low <= high {
+		mid := int(uint(low+high) >> 1)
+		k := h.key(mid)
+		if k < key {
+			low = mid + 1
+		} else if k > key {
+			high = mid - 1
+		} else {
+			return mid
+		}
+	}
+	return -(low + 1)
+}
+
+// keyRange returns the indexes [start, end) of the containers holding
+// values from first to last (included)
+func (h *serializedHeader) keyRange(first, last uint32) (start, end int) {
+	start = h.getIndex(highbits(first))
+	if start < 0 {
+		start = -start - 1
+	}
+	end = h.getIndex(highbits(last))
+	if end < 0 {
+		end = -end - 1
+	} else {
+		end++
+	}
+	return start, end
+}
+
+// containerSize returns the number of bytes of container i, checking that
+// they lie within the buffer
+func (h *serializedHeader) containerSize(i int) (int, error) {
+	off := h.offset(i)
+	var n int
+	if h.isRunContainer(i) {
+		if off < 0 || len(h.buf)-off < 2 {
+			return 0, fmt.Errorf("malformed bitmap, failed to read run container %d size", i)
+		}
+		n = 2 + 4*int(binary.LittleEndian.Uint16(h.buf[off:]))
+	} else if card := h.cardinality(i); card > arrayDefaultMaxSize {
+		n = arrayDefaultMaxSize * 2
+	} else {
+		n = 2 * card
+	}
+	if off < 0 || len(h.buf)-off < n {
+		return 0, fmt.Errorf("malformed bitmap, failed to read container %d content", i)
+	}
+	return n, nil
+}
+
+// checkBounds checks that all the containers lie within the buffer
+func (h *serializedHeader) checkBounds() error {
+	for i := 0; i < h.size; i++ {
+		if _, err := h.containerSize(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// container decodes container i, referencing the buffer where possible as
+// FromBuffer does
+func (h *serializedHeader) container(i int) (container, error) {
+	n, err := h.containerSize(i)
+	if err != nil {
+		return nil, err
+	}
+	off := h.offset(i)
+	card := h.cardinality(i)
+	if h.isRunContainer(i) {
+		return &runContainer16{
+			iv:   byteSliceAsInterval16Slice(h.buf[off+2 : off+n : off+n]),
+			card: int64(card),
+		}, nil
+	}
+	if card > arrayDefaultMaxSize {
+		return &bitmapContainer{
+			cardinality: card,
+			bitmap:      byteSliceAsUint64Slice(h.buf[off : off+n : off+n]),
+		}, nil
+	}
+	return &arrayContainer{byteSliceAsUint16Slice(h.buf[off : off+n : off+n])}, nil
+}
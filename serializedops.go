@@ -0,0 +1,121 @@
+package roaring
+
+// The functions below query bitmaps serialized in the portable format
+// (see ToBytes) without deserializing them: they only read the headers and
+// interpret the payloads of the containers they need in place.
+
+// SerializedContains returns true if x is in the bitmap serialized in buf
+func SerializedContains(buf []byte, x uint32) (bool, error) {
+	h, err := parseSerializedHeader(buf)
+	if err != nil {
+		return false, err
+	}
+	i := h.getIndex(highbits(x))
+	if i < 0 {
+		return false, nil
+	}
+	c, err := h.container(i)
+	if err != nil {
+		return false, err
+	}
+	return c.contains(lowbits(x)), nil
+}
+
+// SerializedGetCardinality returns the number of integers in the bitmap
+// serialized in buf, reading only its headers
+func SerializedGetCardinality(buf []byte) (uint64, error) {
+	h, err := parseSerializedHeader(buf)
+	if err != nil {
+		return 0, err
+	}
+	size := uint64(0)
+	for i := 0; i < h.size; i++ {
+		size += uint64(h.cardinality(i))
+	}
+	return size, nil
+}
+
+// SerializedRank returns the number of integers that are smaller or equal
+// to x in the bitmap serialized in buf
+func SerializedRank(buf []byte, x uint32) (uint64, error) {
+	h, err := parseSerializedHeader(buf)
+	if err != nil {
+		return 0, err
+	}
+	i := h.getIndex(highbits(x))
+	n := i
+	if i < 0 {
+		n = -i - 1
+	}
+	size := uint64(0)
+	for j := 0; j < n; j++ {
+		size += uint64(h.cardinality(j))
+	}
+	if i >= 0 {
+		c, err := h.container(i)
+		if err != nil {
+			return 0, err
+		}
+		size += uint64(c.rank(lowbits(x)))
+	}
+	return size, nil
+}
+
+// SerializedAndCardinality returns the cardinality of the intersection of
+// the bitmaps serialized in buf1 and buf2
+func SerializedAndCardinality(buf1, buf2 []byte) (uint64, error) {
+	answer := uint64(0)
+	err := serializedAndWalk(buf1, buf2, func(c1, c2 container) bool {
+		answer += uint64(c1.andCardinality(c2))
+		return true
+	})
+	return answer, err
+}
+
+// SerializedIntersects returns true if the bitmaps serialized in buf1 and
+// buf2 have at least one integer in common
+func SerializedIntersects(buf1, buf2 []byte) (bool, error) {
+	answer := false
+	err := serializedAndWalk(buf1, buf2, func(c1, c2 container) bool {
+		answer = c1.intersects(c2)
+		return !answer
+	})
+	return answer, err
+}
+
+// serializedAndWalk calls f on the pairs of containers that share a key in
+// the bitmaps serialized in buf1 and buf2, until f returns false
+func serializedAndWalk(buf1, buf2 []byte, f func(c1, c2 container) bool) error {
+	h1, err := parseSerializedHeader(buf1)
+	if err != nil {
+		return err
+	}
+	h2, err := parseSerializedHeader(buf2)
+	if err != nil {
+		return err
+	}
+	pos1, pos2 := 0, 0
+	for pos1 < h1.size && pos2 < h2.size {
+		k1, k2 := h1.key(pos1), h2.key(pos2)
+		if k1 < k2 {
+			pos1++
+		} else if k1 > k2 {
+			pos2++
+		} else {
+			c1, err := h1.container(pos1)
+			if err != nil {
+				return err
+			}
+			c2, err := h2.container(pos2)
+			if err != nil {
+				return err
+			}
+			if !f(c1, c2) {
+				return nil
+			}
+			pos1++
+			pos2++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package roaring
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerializedOps(t *testing.T) {
+	r := rand.New(rand.NewSource(20))
+	bitmaps := lazyTestBitmaps()
+	bufs := make([][]byte, len(bitmaps))
+	for i, rb := range bitmaps {
+		buf, err := rb.ToBytes()
+		require.NoError(t, err)
+		bufs[i] = buf
+
+		card, err := SerializedGetCardinality(buf)
+		require.NoError(t, err)
+		assert.Equal(t, rb.GetCardinality(), card)
+
+		values := []uint32{0, 1, 1 << 16, MaxUint32}
+		it := rb.Iterator()
+		for it.HasNext() {
+			x := it.Next()
+			if r.Intn(100) == 0 {
+				values = append(values, x, x+1)
+			}
+		}
+		for j := 0; j < 100; j++ {
+			values = append(values, uint32(r.Intn(40<<16)))
+		}
+		for _, x := range values {
+			contains, err := SerializedContains(buf, x)
+			require.NoError(t, err)
+			assert.Equal(t, rb.Contains(x), contains, "%d", x)
+			rank, err := SerializedRank(buf, x)
+			require.NoError(t, err)
+			assert.Equal(t, rb.Rank(x), rank, "%d", x)
+		}
+	}
+
+	for i, rb1 := range bitmaps {
+		for j, rb2 := range bitmaps {
+			card, err := SerializedAndCardinality(bufs[i], bufs[j])
+			require.NoError(t, err)
+			assert.Equal(t, rb1.AndCardinality(rb2), card, "%d %d", i, j)
+			intersects, err := SerializedIntersects(bufs[i], bufs[j])
+			require.NoError(t, err)
+			assert.Equal(t, rb1.Intersects(rb2), intersects, "%d %d", i, j)
+		}
+	}
+}
+
+func TestSerializedOpsMalformed(t *testing.T) {
+	buf, err := frozenTestBitmap().ToBytes()
+	require.NoError(t, err)
+	for _, n := range []int{0, 3, 10} {
+		_, err = SerializedGetCardinality(buf[:n])
+		assert.Error(t, err, "n=%d", n)
+		_, err = SerializedAndCardinality(buf, buf[:n])
+		assert.Error(t, err, "n=%d", n)
+	}
+	// the last container lies past the end of the buffer
+	truncated := buf[:len(buf)-1]
+	_, err = SerializedContains(truncated, MaxUint32)
+	assert.Error(t, err)
+	_, err = SerializedRank(truncated, MaxUint32)
+	assert.Error(t, err)
+	_, err = SerializedAndCardinality(truncated, truncated)
+	assert.Error(t, err)
+}
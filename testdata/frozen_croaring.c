@@ -0,0 +1,45 @@
+// Generates frozen_croaring.bin, the fixture of TestFrozenCRoaringFixture,
+// with CRoaring's roaring_bitmap_frozen_serialize. The bitmap must match
+// frozenFixtureBitmap in frozen_test.go. frozen_croaring.py writes the
+// same bytes without CRoaring.
+//
+// With roaring.c and roaring.h from the CRoaring amalgamation:
+//
+//	cc -O2 -o frozen_croaring frozen_croaring.c roaring.c
+//	./frozen_croaring frozen_croaring.bin
+#include <stdio.h>
+#include <stdlib.h>
+
+#include "roaring.h"
+
+int main(int argc, char **argv) {
+    if (argc != 2) {
+        fprintf(stderr, "usage: %s output\n", argv[0]);
+        return 1;
+    }
+    roaring_bitmap_t *rb = roaring_bitmap_create();
+    // array container
+    for (uint32_t i = 0; i < 1000; i++) {
+        roaring_bitmap_add(rb, i * 7);
+    }
+    // bitset container
+    for (uint32_t i = 0; i < 20000; i++) {
+        roaring_bitmap_add(rb, (3u << 16) + 2 * i);
+    }
+    // run containers
+    roaring_bitmap_add_range(rb, (5u << 16) + 100, (7u << 16) + 200);
+    roaring_bitmap_add(rb, UINT32_MAX);
+    roaring_bitmap_run_optimize(rb);
+
+    size_t size = roaring_bitmap_frozen_size_in_bytes(rb);
+    char *buf = malloc(size);
+    roaring_bitmap_frozen_serialize(rb, buf);
+    FILE *f = fopen(argv[1], "wb");
+    if (f == NULL || fwrite(buf, 1, size, f) != size || fclose(f) != 0) {
+        perror(argv[1]);
+        return 1;
+    }
+    free(buf);
+    roaring_bitmap_free(rb);
+    return 0;
+}
@@ -0,0 +1,93 @@
+# Generates frozen_croaring.bin, the fixture of TestFrozenCRoaringFixture,
+# without CRoaring: it transcribes roaring_bitmap_frozen_serialize from
+# CRoaring's roaring.c, and chooses the containers as CRoaring's
+# roaring_bitmap_run_optimize does. It does not share any code with the Go
+# encoder. frozen_croaring.c builds the same bitmap with CRoaring itself,
+# its output must be identical.
+#
+#	python3 frozen_croaring.py frozen_croaring.bin
+import struct
+import sys
+
+FROZEN_COOKIE = 13766
+BITSET_CONTAINER_TYPE = 1
+ARRAY_CONTAINER_TYPE = 2
+RUN_CONTAINER_TYPE = 3
+DEFAULT_MAX_SIZE = 4096
+
+
+def fixture_values():
+    values = set()
+    # array container
+    values.update(i * 7 for i in range(1000))
+    # bitset container
+    values.update((3 << 16) + 2 * i for i in range(20000))
+    # run containers
+    values.update(range((5 << 16) + 100, (7 << 16) + 200))
+    values.add(0xFFFFFFFF)
+    return values
+
+
+def runs_of(lows):
+    runs = []
+    for v in lows:
+        if runs and runs[-1][0] + runs[-1][1] + 1 == v:
+            runs[-1][1] += 1
+        else:
+            runs.append([v, 0])
+    return runs
+
+
+def containers(values):
+    by_key = {}
+    for v in values:
+        by_key.setdefault(v >> 16, []).append(v & 0xFFFF)
+    for key in sorted(by_key):
+        lows = sorted(by_key[key])
+        runs = runs_of(lows)
+        # run_optimize keeps the smallest serialized form
+        size_as_run = 2 + 4 * len(runs)
+        if len(lows) <= DEFAULT_MAX_SIZE:
+            size_as_other = 2 * len(lows)
+            other = ARRAY_CONTAINER_TYPE
+        else:
+            size_as_other = 8192
+            other = BITSET_CONTAINER_TYPE
+        if size_as_run < size_as_other:
+            yield key, RUN_CONTAINER_TYPE, lows, runs
+        else:
+            yield key, other, lows, runs
+
+
+def frozen_serialize(values):
+    bitset_zone, run_zone, array_zone = b"", b"", b""
+    keys, counts, typecodes = b"", b"", b""
+    n = 0
+    for key, typecode, lows, runs in containers(values):
+        n += 1
+        if typecode == BITSET_CONTAINER_TYPE:
+            words = [0] * 1024
+            for v in lows:
+                words[v >> 6] |= 1 << (v & 63)
+            bitset_zone += struct.pack("<1024Q", *words)
+            count = len(lows) - 1
+        elif typecode == RUN_CONTAINER_TYPE:
+            for value, length in runs:
+                run_zone += struct.pack("<HH", value, length)
+            count = len(runs)
+        else:
+            array_zone += struct.pack("<%dH" % len(lows), *lows)
+            count = len(lows) - 1
+        keys += struct.pack("<H", key)
+        counts += struct.pack("<H", count)
+        typecodes += struct.pack("<B", typecode)
+    header = struct.pack("<I", (n << 15) | FROZEN_COOKIE)
+    return bitset_zone + run_zone + array_zone + keys + counts + typecodes + header
+
+
+if __name__ == "__main__":
+    if len(sys.argv) != 2:
+        sys.stderr.write("usage: %s output\n" % sys.argv[0])
+        sys.exit(1)
+    with open(sys.argv[1], "wb") as f:
+        f.write(frozen_serialize(fixture_values()))